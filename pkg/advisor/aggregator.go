@@ -0,0 +1,65 @@
+package advisor
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Aggregator turns the usage samples of a container during the window into a suggested value
+type Aggregator interface {
+	Aggregate(values []float64) float64
+}
+
+// AggregatorFunc is a function used as Aggregator
+type AggregatorFunc func(values []float64) float64
+
+func (f AggregatorFunc) Aggregate(values []float64) float64 {
+	return f(values)
+}
+
+// aggregators are the aggregations selectable by name, quantile is built from --quantile
+var aggregators = map[string]Aggregator{
+	aggregationAvg: AggregatorFunc(float64Average),
+	aggregationMax: AggregatorFunc(float64Peak),
+}
+
+// RegisterAggregator makes the aggregator selectable with --request-aggregation and --limit-aggregation.
+// Prometheus computes the built-in aggregations, a registered one gets the raw samples of the window instead.
+func RegisterAggregator(name string, aggregator Aggregator) {
+	aggregators[name] = aggregator
+}
+
+// aggregator returns the aggregation of the name, the quantile without --quantile is the average
+func (o *Options) aggregator(name string) (Aggregator, bool) {
+	if name == aggregationQuantile {
+		if o.Quantile == "" {
+			return aggregators[aggregationAvg], true
+		}
+		quantile, _ := strconv.ParseFloat(o.Quantile, 64)
+		return AggregatorFunc(func(values []float64) float64 {
+			return float64Percentile(values, quantile)
+		}), true
+	}
+	aggregator, ok := aggregators[name]
+	return aggregator, ok
+}
+
+// aggregatorNames lists the selectable aggregations for the error messages
+func aggregatorNames() []string {
+	names := []string{aggregationQuantile}
+	for name := range aggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// customAggregation tells if the requests or limits use a registered aggregator, which needs the raw samples
+func (o *Options) customAggregation() bool {
+	for _, name := range []string{o.RequestAggregation, o.LimitAggregation} {
+		if name != aggregationAvg && name != aggregationMax && name != aggregationQuantile {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// exceedsThresholds returns true if the suggestion is outside of the tolerated range of the current value
+// The thresholds only decide what --apply and --interactive patch and what --changes-only hides, the report shows every suggestion.
+func (o *Options) exceedsThresholds(current float64, suggested float64) bool {
+	if current <= 0 {
+		return suggested > 0
+	}
+	ratio := suggested * 100 / current
+	return ratio < o.DecreaseThreshold || ratio > o.IncreaseThreshold
+}
+
+// applyRecommendations patches the workloads with the suggested resources
+func (o *Options) applyRecommendations(ctx context.Context, w io.Writer, recommendations []Recommendation) error {
+	order, patches := workloadPatches(recommendations, o.exceedsThresholds)
+	opts := metav1.PatchOptions{}
+	mode := ""
+	if o.DryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+		mode = " (dry run)"
+	}
+
+	for _, wl := range order {
+		if wl.Kind == "pod" {
+			fmt.Fprintf(w, "Skipped pod/%s in namespace %s, resources of a running pod cannot be patched\n", wl.Name, wl.Namespace)
+			continue
+		}
+		content, err := json.Marshal(patches[wl])
+		if err != nil {
+			return err
+		}
+
+		switch wl.Kind {
+		case "deployment":
+			_, err = o.client.AppsV1().Deployments(wl.Namespace).Patch(ctx, wl.Name, types.StrategicMergePatchType, content, opts)
+		case "statefulset":
+			_, err = o.client.AppsV1().StatefulSets(wl.Namespace).Patch(ctx, wl.Name, types.StrategicMergePatchType, content, opts)
+		case "daemonset":
+			_, err = o.client.AppsV1().DaemonSets(wl.Namespace).Patch(ctx, wl.Name, types.StrategicMergePatchType, content, opts)
+		case "cronjob":
+			_, err = o.client.BatchV1().CronJobs(wl.Namespace).Patch(ctx, wl.Name, types.StrategicMergePatchType, content, opts)
+		default:
+			err = fmt.Errorf("patching %s is not supported", wl.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("could not patch %s/%s in namespace %s: %v", wl.Kind, wl.Name, wl.Namespace, err)
+		}
+		fmt.Fprintf(w, "Patched%s %s/%s in namespace %s: %s\n", mode, wl.Kind, wl.Name, wl.Namespace, content)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// cronJobPodRegex matches the pods of the jobs created by the cronjob, <cronjob>-<scheduled time>-<random>
+func cronJobPodRegex(cronjob batchv1.CronJob) string {
+	return fmt.Sprintf("%s-[0-9]+-%s", regexp.QuoteMeta(cronjob.Name), generatedSuffix)
+}
+
+// cronJobMetrics finds the usage of the recently completed job pods of the cronjob.
+// The pods are short lived, so the quantiles would be based on a few samples only and the peak is used for the requests.
+func (o *Options) cronJobMetrics(ctx context.Context, cronjob batchv1.CronJob) (prometheusMetrics, error) {
+	output, err := o.podUsage(ctx, cronjob.Namespace, cronJobPodRegex(cronjob))
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+
+	// metrics-server has only the current usage, it already is the request
+	if o.Backend != backendMetricsServer {
+		selector := fmt.Sprintf(`namespace="%s", pod=~"%s"`, cronjob.Namespace, cronJobPodRegex(cronjob))
+		window := o.historyWindow()
+		output.RequestCPU, err = queryStatistic(ctx, o.promClient, fmt.Sprintf(usageMax, o.cpuRange(selector, window)), o.queryTime())
+		if err != nil {
+			return newPrometheusMetrics(), err
+		}
+		output.RequestMem, err = queryStatistic(ctx, o.promClient, fmt.Sprintf(podMemoryRequest, fmt.Sprintf(usageMax, o.memoryRange(selector, window))), o.queryTime())
+		if err != nil {
+			return newPrometheusMetrics(), err
+		}
+	}
+	return o.aggregateMetrics([]prometheusMetrics{output}), nil
+}
+
+func (o *Options) analyzeCronJob(data []tableEntry, cronjob batchv1.CronJob, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	w := Workload{Namespace: cronjob.Namespace, Kind: "cronjob", Name: cronjob.Name}
+	replicas := float64(1)
+	if cronjob.Spec.JobTemplate.Spec.Parallelism != nil {
+		replicas = float64(*cronjob.Spec.JobTemplate.Spec.Parallelism)
+	}
+	return o.analyzeContainers(data, w, cronjob.Spec.JobTemplate.Spec.Template.Spec, replicas, finalMetrics)
+}
@@ -0,0 +1,55 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCronJobMetricsPeakRequests(t *testing.T) {
+	// the peak of the job pods differs from every other statistic of their usage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Error(err)
+		}
+		value := "0.5"
+		if strings.HasPrefix(r.Form.Get("query"), "max_over_time(") {
+			value = "2"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [
+			{"metric": {"container": "backup", "pod": "backup-28000000-x2x4z"}, "value": [1600000000, "%s"]}]}}`, value)
+	}))
+	t.Cleanup(server.Close)
+	client, err := makePrometheusClientForURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{
+		Window:             "7d",
+		RequestAggregation: aggregationAvg,
+		LimitAggregation:   aggregationAvg,
+		LimitMargin:        0.2,
+		CPUMetric:          cpuUsageSeries,
+		MemMetric:          memoryUsageSeries,
+		cpuRound:           100,
+		memRound:           100,
+		promClient:         client,
+	}
+	cronjob := batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "backup"}}
+	metrics, err := o.cronJobMetrics(context.Background(), cronjob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.RequestCPU["backup"] != 2 {
+		t.Errorf("request cpu = %g, want the peak 2", metrics.RequestCPU["backup"])
+	}
+}
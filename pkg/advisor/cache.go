@@ -0,0 +1,96 @@
+package advisor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+)
+
+// queryCache stores raw prometheus query results on disk
+type queryCache struct {
+	dir string
+	ttl time.Duration
+	// scope separates the results of different prometheus endpoints and query parameters
+	scope string
+}
+
+type cachedResult struct {
+	Type   prommodel.ValueType `json:"type"`
+	Result json.RawMessage     `json:"result"`
+}
+
+func newQueryCache(dir string, ttl time.Duration, scope string) (*queryCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache ttl must be positive, got %v", ttl)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &queryCache{dir: dir, ttl: ttl, scope: scope}, nil
+}
+
+// path returns the cache file for the query, timestamps inside the same ttl bucket share the file
+func (c *queryCache) path(query string, ts time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s@%d", c.scope, query, ts.Truncate(c.ttl).Unix())))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *queryCache) get(query string, ts time.Time) (prommodel.Value, bool) {
+	file := c.path(query, ts)
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+
+	cached := cachedResult{}
+	err = json.Unmarshal(content, &cached)
+	if err != nil {
+		return nil, false
+	}
+
+	var value prommodel.Value
+	switch cached.Type {
+	case prommodel.ValVector:
+		vector := prommodel.Vector{}
+		err = json.Unmarshal(cached.Result, &vector)
+		value = vector
+	case prommodel.ValMatrix:
+		matrix := prommodel.Matrix{}
+		err = json.Unmarshal(cached.Result, &matrix)
+		value = matrix
+	case prommodel.ValScalar:
+		scalar := &prommodel.Scalar{}
+		err = json.Unmarshal(cached.Result, scalar)
+		value = scalar
+	default:
+		return nil, false
+	}
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *queryCache) set(query string, ts time.Time, value prommodel.Value) error {
+	result, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(cachedResult{Type: value.Type(), Result: result})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(query, ts), content, 0644)
+}
@@ -0,0 +1,77 @@
+package advisor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// loadConfig sets the flags from the --config file. The keys are the flag names and lists are joined with commas,
+// e.g. namespaces: [app, db]. Flags given on the command line override the values of the file.
+func loadConfig(cmd *cobra.Command, path string) error {
+	flags := cmd.Flags()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %v", err)
+	}
+
+	values := map[string]interface{}{}
+	err = yaml.Unmarshal(content, &values)
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	// sorted so the errors do not depend on the map order
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flag := flags.Lookup(key)
+		if flag == nil || key == "config" {
+			return fmt.Errorf("unknown option '%s' in config file %s", key, path)
+		}
+		if flag.Changed {
+			continue
+		}
+		value, err := configValue(values[key])
+		if err != nil {
+			return fmt.Errorf("invalid value of '%s' in config file %s: %v", key, path, err)
+		}
+		err = flags.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("invalid value of '%s' in config file %s: %v", key, path, err)
+		}
+	}
+	return nil
+}
+
+// configValue formats the yaml value like it would be given on the command line
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
@@ -0,0 +1,21 @@
+package advisor
+
+const crashLoopBackOff = "CrashLoopBackOff"
+
+// crashLooping tells if the container was in CrashLoopBackOff, its usage does not show what it needs when running
+func crashLooping(metrics prometheusMetrics, container string) bool {
+	return metrics.CrashLooping[container] > 0
+}
+
+// noSuggestionEntry is the table entry of a container without a suggestion, either it has no usage data or it is crash
+// looping and a suggestion from its usage would be too small
+func (o *Options) noSuggestionEntry(w Workload, name string, container string, metrics prometheusMetrics) tableEntry {
+	reason := "no metrics"
+	if crashLooping(metrics, container) {
+		reason = "no data (crashlooping)"
+		if o.hasEnoughData(metrics, container) {
+			reason = "no suggestion (crashlooping)"
+		}
+	}
+	return tableEntry{workload: w, container: name, reason: reason}
+}
@@ -0,0 +1,34 @@
+package advisor
+
+import (
+	"testing"
+)
+
+func TestNoSuggestionEntry(t *testing.T) {
+	w := Workload{Namespace: "shop", Kind: "deployment", Name: "cart"}
+	withData := prometheusMetrics{
+		RequestCPU: map[string]float64{"app": 0.1},
+		RequestMem: map[string]float64{"app": 1024},
+	}
+	tests := []struct {
+		name    string
+		metrics prometheusMetrics
+		want    string
+	}{
+		{name: "no metrics", metrics: prometheusMetrics{}, want: "no metrics"},
+		{name: "crash looping without data", metrics: prometheusMetrics{CrashLooping: map[string]float64{"app": 1}}, want: "no data (crashlooping)"},
+		{name: "crash looping with data", metrics: prometheusMetrics{RequestCPU: withData.RequestCPU, RequestMem: withData.RequestMem, CrashLooping: map[string]float64{"app": 1}}, want: "no suggestion (crashlooping)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{}
+			entry := o.noSuggestionEntry(w, "app", "app", tt.metrics)
+			if entry.reason != tt.want {
+				t.Errorf("noSuggestionEntry() reason = %s, want %s", entry.reason, tt.want)
+			}
+		})
+	}
+	if crashLooping(withData, "app") {
+		t.Error("crashLooping() without CrashLooping = true, want false")
+	}
+}
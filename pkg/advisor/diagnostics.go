@@ -0,0 +1,118 @@
+package advisor
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityInfo:
+		return "info"
+	case severityWarning:
+		return "warning"
+	case severityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+func (c diagnosticCategory) String() string {
+	switch c {
+	case categoryUndefinedResource:
+		return "undefined-resource"
+	case categoryMissingMetrics:
+		return "missing-metrics"
+	case categoryDisruptionBudget:
+		return "disruption-budget"
+	case categoryPeakUsage:
+		return "peak-usage"
+	case categoryUnusedGPU:
+		return "unused-gpu"
+	case categoryResourceQuota:
+		return "resource-quota"
+	case categoryCrashLoop:
+		return "crash-loop"
+	}
+	return "unknown"
+}
+
+func (o *Options) addDiagnostic(sev severity, category diagnosticCategory, namespace string, resource string, container string, message string) {
+	o.diagnostics = append(o.diagnostics, diagnostic{
+		Severity:  sev,
+		Category:  category,
+		Namespace: namespace,
+		Resource:  resource,
+		Container: container,
+		Message:   message,
+	})
+}
+
+// warnOnce prints the warning only the first time the key is seen during the run, e.g. for an api the cluster does not serve
+func (o *Options) warnOnce(key string, message string) {
+	if o.warned[key] {
+		return
+	}
+	o.warned[key] = true
+	glog.Warning(message)
+}
+
+// diagnoseContainer records missing resource definitions and missing usage data of the container
+func (o *Options) diagnoseContainer(namespace string, resource string, container v1.Container, finalMetrics prometheusMetrics) {
+	if _, ok := finalMetrics.RequestCPU[container.Name]; !ok {
+		o.addDiagnostic(severityWarning, categoryMissingMetrics, namespace, resource, container.Name, "Could not find CPU usage from prometheus")
+	}
+	if _, ok := finalMetrics.RequestMem[container.Name]; !ok {
+		o.addDiagnostic(severityWarning, categoryMissingMetrics, namespace, resource, container.Name, "Could not find memory usage from prometheus")
+	}
+	if at, ok := finalMetrics.CPUPeakAt[container.Name]; ok {
+		o.addDiagnostic(severityInfo, categoryPeakUsage, namespace, resource, container.Name, fmt.Sprintf("CPU usage peaked at %s", at.Format(time.RFC3339)))
+	}
+	if at, ok := finalMetrics.MemPeakAt[container.Name]; ok {
+		o.addDiagnostic(severityInfo, categoryPeakUsage, namespace, resource, container.Name, fmt.Sprintf("Memory usage peaked at %s", at.Format(time.RFC3339)))
+	}
+	if gpus := o.requestedGPUs(container); gpus > 0 && o.GPUMetric != "" {
+		// a gpu without exported metrics tells nothing about its usage
+		if usage, ok := finalMetrics.GPUUsage[container.Name]; !ok {
+			o.addDiagnostic(severityWarning, categoryMissingMetrics, namespace, resource, container.Name, "Could not find GPU usage from prometheus")
+		} else if usage <= 0 {
+			o.addDiagnostic(severityWarning, categoryUnusedGPU, namespace, resource, container.Name, fmt.Sprintf("Requests %d %s but did not use it during the window, consider removing the request", gpus, o.GPUResource))
+		}
+	}
+	if _, ok := container.Resources.Requests[v1.ResourceCPU]; !ok {
+		o.addDiagnostic(severityInfo, categoryUndefinedResource, namespace, resource, container.Name, "Define CPU requests")
+	}
+	if _, ok := container.Resources.Requests[v1.ResourceMemory]; !ok {
+		o.addDiagnostic(severityInfo, categoryUndefinedResource, namespace, resource, container.Name, "Define memory requests")
+	}
+	if _, ok := container.Resources.Limits[v1.ResourceMemory]; !ok {
+		o.addDiagnostic(severityInfo, categoryUndefinedResource, namespace, resource, container.Name, "Define memory limits")
+	}
+}
+
+func (o *Options) printDiagnostics(w io.Writer) {
+	if len(o.diagnostics) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Diagnostics:\n")
+	for _, d := range o.diagnostics {
+		fmt.Fprintf(w, "  [%s] %s %s %s: %s (%s)\n", d.Severity, d.Namespace, d.Resource, d.Container, d.Message, d.Category)
+	}
+}
+
+// requestedGPUs returns the amount of the --gpu-resource extended resource of the container.
+// Extended resources can not be overcommitted, so the limit is used when the request is not set.
+func (o *Options) requestedGPUs(container v1.Container) int64 {
+	name := v1.ResourceName(o.GPUResource)
+	if value, ok := container.Resources.Requests[name]; ok {
+		return value.Value()
+	}
+	if value, ok := container.Resources.Limits[name]; ok {
+		return value.Value()
+	}
+	return 0
+}
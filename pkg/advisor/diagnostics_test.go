@@ -0,0 +1,49 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDiagnoseContainerGPU(t *testing.T) {
+	container := v1.Container{
+		Name: "trainer",
+		Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{"nvidia.com/gpu": apresource.MustParse("1"), v1.ResourceMemory: apresource.MustParse("1Gi")},
+			Requests: v1.ResourceList{
+				v1.ResourceCPU:    apresource.MustParse("1"),
+				v1.ResourceMemory: apresource.MustParse("1Gi"),
+			},
+		},
+	}
+	tests := []struct {
+		name  string
+		usage map[string]float64
+		want  []diagnosticCategory
+	}{
+		{name: "used gpu", usage: map[string]float64{"trainer": 80}, want: nil},
+		{name: "unused gpu", usage: map[string]float64{"trainer": 0}, want: []diagnosticCategory{categoryUnusedGPU}},
+		{name: "missing gpu metrics", usage: map[string]float64{}, want: []diagnosticCategory{categoryMissingMetrics}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{GPUResource: "nvidia.com/gpu", GPUMetric: `DCGM_FI_DEV_GPU_UTIL{%s}`}
+			metrics := prometheusMetrics{
+				RequestCPU: map[string]float64{"trainer": 0.5},
+				RequestMem: map[string]float64{"trainer": 512},
+				GPUUsage:   tt.usage,
+			}
+			o.diagnoseContainer("ml", "deployment/trainer", container, metrics)
+			var got []diagnosticCategory
+			for _, d := range o.diagnostics {
+				got = append(got, d.Category)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnostics = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
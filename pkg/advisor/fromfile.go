@@ -0,0 +1,99 @@
+package advisor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// loadDeployments reads the deployments from a manifest file or from the .yaml, .yml and .json files of a directory.
+// Other kinds in the manifests are skipped.
+func loadDeployments(path string, defaultNamespace string) ([]appsv1.Deployment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = []string{}
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	deployments := []appsv1.Deployment{}
+	for _, file := range files {
+		content, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(content, 4096)
+		for {
+			deployment := appsv1.Deployment{}
+			err = decoder.Decode(&deployment)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				content.Close()
+				return nil, fmt.Errorf("could not parse %s: %v", file, err)
+			}
+			if deployment.Kind != "Deployment" {
+				continue
+			}
+			if deployment.Namespace == "" {
+				deployment.Namespace = defaultNamespace
+			}
+			if deployment.Spec.Replicas == nil {
+				replicas := int32(1)
+				deployment.Spec.Replicas = &replicas
+			}
+			deployments = append(deployments, deployment)
+		}
+		content.Close()
+	}
+	return deployments, nil
+}
+
+// fileNamespaces returns the namespaces of the deployments loaded with --from-file
+func (o *Options) fileNamespaces() []string {
+	seen := make(map[string]bool)
+	namespaces := []string{}
+	for _, deployment := range o.fileDeployments {
+		if !seen[deployment.Namespace] {
+			seen[deployment.Namespace] = true
+			namespaces = append(namespaces, deployment.Namespace)
+		}
+	}
+	return namespaces
+}
+
+// listFileDeployments returns the deployments of the namespace loaded with --from-file matching --selector
+func (o *Options) listFileDeployments(namespace string) (*appsv1.DeploymentList, error) {
+	selector, err := labels.Parse(o.Selector)
+	if err != nil {
+		return nil, err
+	}
+	output := &appsv1.DeploymentList{}
+	for _, deployment := range o.fileDeployments {
+		if deployment.Namespace == namespace && selector.Matches(labels.Set(deployment.Labels)) {
+			output.Items = append(output.Items, deployment)
+		}
+	}
+	return output, nil
+}
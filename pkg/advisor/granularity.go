@@ -0,0 +1,109 @@
+package advisor
+
+import (
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// attributePodUsage gives the usage of the series without a container label to the containers of the pod.
+// The pod usage is split by the share of the container requests, or evenly when the containers request nothing.
+// Containers having series of their own keep them.
+func (o *Options) attributePodUsage(w Workload, spec v1.PodSpec, metrics prometheusMetrics) prometheusMetrics {
+	_, cpu := metrics.RequestCPU[""]
+	_, mem := metrics.RequestMem[""]
+	if !cpu && !mem {
+		return metrics
+	}
+
+	containers := []v1.Container{}
+	for _, container := range spec.Containers {
+		if _, ok := metrics.RequestCPU[container.Name]; ok {
+			continue
+		}
+		if _, ok := metrics.RequestMem[container.Name]; ok {
+			continue
+		}
+		containers = append(containers, container)
+	}
+	if len(containers) > 1 {
+		o.addDiagnostic(severityInfo, categoryMissingMetrics, w.Namespace, w.String(), "", "Usage has no container label, the usage of the pods is split by the share of the container requests")
+	}
+
+	cpuShares := requestShares(containers, v1.ResourceCPU)
+	memShares := requestShares(containers, v1.ResourceMemory)
+	attributed := metrics
+	attributed.RequestCPU = attributeValues(metrics.RequestCPU, cpuShares)
+	attributed.LimitCPU = attributeValues(metrics.LimitCPU, cpuShares)
+	attributed.RequestMem = attributeValues(metrics.RequestMem, memShares)
+	attributed.LimitMem = attributeValues(metrics.LimitMem, memShares)
+	attributed.MinCPU = attributeValues(metrics.MinCPU, cpuShares)
+	attributed.MinMem = attributeValues(metrics.MinMem, memShares)
+	attributed.Samples = attributeCopies(metrics.Samples, containers)
+	attributed.CPUPeakAt = attributeTimes(metrics.CPUPeakAt, containers)
+	attributed.MemPeakAt = attributeTimes(metrics.MemPeakAt, containers)
+	return attributed
+}
+
+// requestShares returns the share of each container of the requests of the resource
+func requestShares(containers []v1.Container, resource v1.ResourceName) map[string]float64 {
+	shares := make(map[string]float64)
+	total := float64(0)
+	for _, container := range containers {
+		total += quantityValue(container.Resources.Requests, resource)
+	}
+	for _, container := range containers {
+		if total > 0 {
+			shares[container.Name] = quantityValue(container.Resources.Requests, resource) / total
+		} else {
+			shares[container.Name] = 1 / float64(len(containers))
+		}
+	}
+	return shares
+}
+
+// attributeValues splits the pod value by the shares, the result is a copy
+func attributeValues(values map[string]float64, shares map[string]float64) map[string]float64 {
+	if values == nil {
+		return nil
+	}
+	output := make(map[string]float64)
+	for container, value := range values {
+		if container != "" {
+			output[container] = value
+		}
+	}
+	if pod, ok := values[""]; ok {
+		for container, share := range shares {
+			output[container] = pod * share
+		}
+	}
+	return output
+}
+
+// attributeCopies gives the pod value as is to the containers, e.g. the amount of samples
+func attributeCopies(values map[string]float64, containers []v1.Container) map[string]float64 {
+	shares := make(map[string]float64)
+	for _, container := range containers {
+		shares[container.Name] = 1
+	}
+	return attributeValues(values, shares)
+}
+
+func attributeTimes(values map[string]time.Time, containers []v1.Container) map[string]time.Time {
+	if values == nil {
+		return nil
+	}
+	output := make(map[string]time.Time)
+	for container, value := range values {
+		if container != "" {
+			output[container] = value
+		}
+	}
+	if at, ok := values[""]; ok {
+		for _, container := range containers {
+			output[container.Name] = at
+		}
+	}
+	return output
+}
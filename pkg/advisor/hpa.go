@@ -0,0 +1,92 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// listHPAs returns the HPAs of the namespace. Kubernetes 1.26 and later do not serve autoscaling/v2beta2 anymore,
+// the cpu targets of autoscaling/v1 are used then. Without either the suggestions are not HPA-adjusted.
+func (o *Options) listHPAs(ctx context.Context, namespace string) ([]autoscalingv2beta2.HorizontalPodAutoscaler, error) {
+	list, err := o.client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if err == nil {
+		return list.Items, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	v1list, err := o.client.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		o.warnOnce("hpa", "the cluster serves no HPA api, the suggestions are not HPA-adjusted")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.warnOnce("hpa", "autoscaling/v2beta2 is not served by the cluster, only the cpu targets of the autoscaling/v1 HPAs are used")
+
+	hpas := []autoscalingv2beta2.HorizontalPodAutoscaler{}
+	for _, hpa := range v1list.Items {
+		converted := autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: hpa.ObjectMeta}
+		converted.Spec.ScaleTargetRef = autoscalingv2beta2.CrossVersionObjectReference{
+			Kind:       hpa.Spec.ScaleTargetRef.Kind,
+			Name:       hpa.Spec.ScaleTargetRef.Name,
+			APIVersion: hpa.Spec.ScaleTargetRef.APIVersion,
+		}
+		if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+			converted.Spec.Metrics = []autoscalingv2beta2.MetricSpec{{
+				Type: autoscalingv2beta2.ResourceMetricSourceType,
+				Resource: &autoscalingv2beta2.ResourceMetricSource{
+					Name:   v1.ResourceCPU,
+					Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.UtilizationMetricType, AverageUtilization: hpa.Spec.TargetCPUUtilizationPercentage},
+				},
+			}}
+		}
+		hpas = append(hpas, converted)
+	}
+	return hpas, nil
+}
+
+// hpaCPUTarget returns the cpu target utilization of the HPA scaling the workload or 0 if there is none
+func hpaCPUTarget(hpas []autoscalingv2beta2.HorizontalPodAutoscaler, kind string, name string) int32 {
+	for _, hpa := range hpas {
+		if hpa.Spec.ScaleTargetRef.Kind != kind || hpa.Spec.ScaleTargetRef.Name != name {
+			continue
+		}
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Type != autoscalingv2beta2.ResourceMetricSourceType || metric.Resource == nil || metric.Resource.Name != v1.ResourceCPU {
+				continue
+			}
+			target := metric.Resource.Target
+			if target.Type == autoscalingv2beta2.UtilizationMetricType && target.AverageUtilization != nil && *target.AverageUtilization > 0 {
+				return *target.AverageUtilization
+			}
+		}
+	}
+	return 0
+}
+
+// hpaAdjusted scales the cpu request usage so that the usage is at the target utilization of the HPA.
+// Without this the HPA would scale out as soon as the usage reaches the suggested request.
+func (o *Options) hpaAdjusted(metrics prometheusMetrics, target int32) prometheusMetrics {
+	output := metrics.copy()
+	for k, v := range metrics.RequestCPU {
+		output.RequestCPU[k] = o.roundCPU(v * 100 / float64(target))
+	}
+	for k, v := range metrics.LimitCPU {
+		if output.RequestCPU[k] > v {
+			output.LimitCPU[k] = output.RequestCPU[k]
+		}
+	}
+	return output
+}
+
+func hpaNote(target int32) string {
+	return fmt.Sprintf("HPA-adjusted for %d%% cpu", target)
+}
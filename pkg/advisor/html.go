@@ -0,0 +1,120 @@
+package advisor
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// htmlReport is a self-contained page, the table is sorted by clicking the headers
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>resource-advisor report{{if .Cluster}} of {{.Cluster}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th { background: #eee; cursor: pointer; }
+td.name { text-align: left; }
+td.increase { color: #b00; }
+</style>
+</head>
+<body>
+<h1>resource-advisor report{{if .Cluster}} of {{.Cluster}}{{end}}</h1>
+<p>Generated {{.Generated}} by resource-advisor {{.Version}}</p>
+<h2>Total savings</h2>
+{{range .Summary}}<p>{{.}}</p>
+{{end}}<h2>Recommendations</h2>
+<table id="recommendations">
+<thead><tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td class="{{.Class}}" data-value="{{.Value}}">{{.Text}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+<script>
+document.querySelectorAll("#recommendations th").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#recommendations tbody");
+    var ascending = th.dataset.order !== "asc";
+    th.dataset.order = ascending ? "asc" : "desc";
+    Array.from(body.rows).sort(function (a, b) {
+      var x = a.cells[column].dataset.value, y = b.cells[column].dataset.value;
+      var order = isNaN(x) || isNaN(y) ? x.localeCompare(y) : x - y;
+      return ascending ? order : -order;
+    }).forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// htmlCell is a table cell, the value is what the column is sorted by
+type htmlCell struct {
+	Text  string
+	Value string
+	Class string
+}
+
+func textCell(text string) htmlCell {
+	return htmlCell{Text: text, Value: text, Class: "name"}
+}
+
+// changeCell shows the current and the suggested value, sorted by the suggestion
+func changeCell(current string, suggested string, value float64) htmlCell {
+	return htmlCell{Text: fmt.Sprintf("%s → %s", current, suggested), Value: formatFloat(value)}
+}
+
+func savingsCell(text string, value float64) htmlCell {
+	cell := htmlCell{Text: text, Value: formatFloat(value)}
+	if value < 0 {
+		cell.Class = "increase"
+	}
+	return cell
+}
+
+// htmlSummary returns the lines of the total savings like they are printed for the table output
+func (o *Options) htmlSummary() []string {
+	var summary strings.Builder
+	if len(o.envProfiles) == 0 {
+		o.printSavings(&summary, o.totals)
+		o.printCost(&summary, o.totalCPUSave, o.totalMemSave)
+	}
+	for _, profile := range o.envProfiles {
+		fmt.Fprintf(&summary, "%s (%.2fx): ", profile, o.envMultipliers[profile])
+		o.printSavings(&summary, o.profileSavings[profile])
+		o.printCost(&summary, o.profileCPUSave[profile], o.profileMemSave[profile])
+	}
+	return strings.Split(strings.TrimSpace(summary.String()), "\n")
+}
+
+// renderHTML writes the recommendations as a html page with the savings summary on top
+func (o *Options) renderHTML(w io.Writer, recommendations []Recommendation) error {
+	rows := [][]htmlCell{}
+	for _, r := range recommendations {
+		rows = append(rows, []htmlCell{
+			textCell(r.Workload.Namespace),
+			textCell(r.Workload.String()),
+			textCell(r.Container),
+			{Text: formatFloat(r.Replicas), Value: formatFloat(r.Replicas)},
+			changeCell(cpuQuantity(r.CurrentRequestCPU), cpuQuantity(r.RequestCPU), r.RequestCPU),
+			changeCell(o.byteCount(int64(r.CurrentRequestMem)), o.byteCount(int64(r.RequestMem)), r.RequestMem),
+			changeCell(cpuQuantity(r.CurrentLimitCPU), cpuQuantity(r.LimitCPU), r.LimitCPU),
+			changeCell(o.byteCount(int64(r.CurrentLimitMem)), o.byteCount(int64(r.LimitMem)), r.LimitMem),
+			savingsCell(signedCores(r.CPUSavings), r.CPUSavings),
+			savingsCell(o.signedBytes(r.MemSavings), r.MemSavings),
+		})
+	}
+	return htmlReport.Execute(w, map[string]interface{}{
+		"Cluster":   o.ClusterName,
+		"Version":   Version,
+		"Generated": time.Now().Format(time.RFC3339),
+		"Summary":   o.htmlSummary(),
+		"Header":    []string{"Namespace", "Resource", "Container", "Replicas", "Request CPU", "Request MEM", "Limit CPU", "Limit MEM", "CPU Savings", "MEM Savings"},
+		"Rows":      rows,
+	})
+}
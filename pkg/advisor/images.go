@@ -0,0 +1,179 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	prommodel "github.com/prometheus/common/model"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	groupCPUUsage    = `avg by (container, %[1]s) (avg_over_time(%[2]s) * on (%[3]s) group_left(%[1]s) max by (%[3]s, %[1]s) (max_over_time(%[4]s[%[5]s])))`
+	groupMemoryUsage = `avg by (container, %[1]s) (avg_over_time(%[2]s) * on (%[3]s) group_left(%[1]s) max by (%[3]s, %[1]s) (max_over_time(%[4]s[%[5]s]))) / 1024 / 1024`
+	groupFirstSeen   = `min by (%[1]s) (min_over_time(timestamp(%[2]s)[%[3]s:1h]))`
+	imageInfo        = `kube_pod_container_info{namespace="%s", pod=~"%s"}`
+	podLabelsInfo    = `kube_pod_labels{namespace="%s", pod=~"%s"}`
+)
+
+// usageGrouping tells how the usage of a deployment is broken down, by the container image or by a pod label
+type usageGrouping struct {
+	// label holds the group in the info series, e.g. image or label_version
+	label string
+	// info is the info series template taking the namespace and the pod regex
+	info string
+	// join are the labels matching the usage series to the info series
+	join string
+	// firstSeen are the labels the first seen time is tracked by
+	firstSeen string
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// grouping returns the breakdown selected by --by-image or --by-label
+func (o *Options) grouping() usageGrouping {
+	if o.ByLabel != "" {
+		// kube-state-metrics exposes the pod labels as label_<name> with the invalid characters replaced
+		label := "label_" + invalidLabelChars.ReplaceAllString(o.ByLabel, "_")
+		return usageGrouping{label: label, info: podLabelsInfo, join: "namespace, pod", firstSeen: label}
+	}
+	return usageGrouping{label: "image", info: imageInfo, join: "namespace, pod, container", firstSeen: "container, image"}
+}
+
+type imageUsage struct {
+	Container string
+	Image     string
+	FirstSeen time.Time
+	CPU       float64
+	Mem       float64
+}
+
+// deploymentPodRegex matches the pods of all replicasets of the deployment.
+// The hashes cannot contain dashes so pods of deployments sharing a name prefix (app and app-api) do not match,
+// the regex must still always be used together with a namespace matcher.
+func deploymentPodRegex(deployment appsv1.Deployment) string {
+	return fmt.Sprintf("%s-%s+-%s", regexp.QuoteMeta(deployment.Name), generatedChars, generatedSuffix)
+}
+
+func queryVector(ctx context.Context, client *promClient, request string, now time.Time) (prommodel.Vector, error) {
+	response, _, err := queryPrometheus(ctx, client, request, now)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying statistic %v", err)
+	}
+	asSamples, ok := response.(prommodel.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type %T for query '%s'", response, request)
+	}
+	return asSamples, nil
+}
+
+// queryImageUsage returns the usage of the deployment containers per image or pod label value,
+// ordered by the time the image or the value was first seen
+func (o *Options) queryImageUsage(ctx context.Context, deployment appsv1.Deployment) ([]imageUsage, error) {
+	now := o.queryTime()
+	ns := deployment.Namespace
+	pods := deploymentPodRegex(deployment)
+	selector := fmt.Sprintf(`namespace="%s", pod=~"%s"`, ns, pods)
+	group := o.grouping()
+	info := fmt.Sprintf(group.info, ns, pods)
+
+	usages := make(map[string]*imageUsage)
+	get := func(sample *prommodel.Sample) *imageUsage {
+		container := string(sample.Metric["container"])
+		image := string(sample.Metric[prommodel.LabelName(group.label)])
+		key := container + "/" + image
+		if _, ok := usages[key]; !ok {
+			usages[key] = &imageUsage{Container: container, Image: image}
+		}
+		return usages[key]
+	}
+
+	// pod labels are not per container, the first seen time is then shared by the containers
+	firstSeen := make(map[string]time.Time)
+	samples, err := queryVector(ctx, o.promClient, fmt.Sprintf(groupFirstSeen, group.firstSeen, info, o.Window), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		key := string(sample.Metric["container"]) + "/" + string(sample.Metric[prommodel.LabelName(group.label)])
+		firstSeen[key] = time.Unix(int64(sample.Value), 0)
+	}
+
+	samples, err = queryVector(ctx, o.promClient, fmt.Sprintf(groupCPUUsage, group.label, o.cpuRange(selector, o.Window), group.join, info, o.Window), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		get(sample).CPU = float64(sample.Value)
+	}
+
+	samples, err = queryVector(ctx, o.promClient, fmt.Sprintf(groupMemoryUsage, group.label, o.memoryRange(selector, o.Window), group.join, info, o.Window), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		get(sample).Mem = float64(sample.Value)
+	}
+
+	output := []imageUsage{}
+	for _, usage := range usages {
+		if seen, ok := firstSeen[usage.Container+"/"+usage.Image]; ok {
+			usage.FirstSeen = seen
+		} else {
+			usage.FirstSeen = firstSeen["/"+usage.Image]
+		}
+		output = append(output, *usage)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		if output[i].Container != output[j].Container {
+			return output[i].Container < output[j].Container
+		}
+		return output[i].FirstSeen.Before(output[j].FirstSeen)
+	})
+	return output, nil
+}
+
+// analyzeImages appends a row per container image or label value, comparing the usage to the previous one of the same container
+func analyzeImages(data [][]string, deployment appsv1.Deployment, usages []imageUsage) [][]string {
+	var previous *imageUsage
+	for i := range usages {
+		usage := usages[i]
+		change := "-"
+		if previous != nil && previous.Container == usage.Container {
+			change = fmt.Sprintf("CPU %s, MEM %s", percentChange(previous.CPU, usage.CPU), percentChange(previous.Mem, usage.Mem))
+		}
+		data = append(data, []string{
+			deployment.Namespace,
+			fmt.Sprintf("deployment/%s", deployment.Name),
+			usage.Container,
+			usage.Image,
+			usage.FirstSeen.Format(time.RFC3339),
+			fmt.Sprintf("%dm", int(usage.CPU*1000)),
+			fmt.Sprintf("%dMi", int(usage.Mem)),
+			change,
+		})
+		previous = &usages[i]
+	}
+	return data
+}
+
+func percentChange(previous float64, current float64) string {
+	if previous == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.0f%%", (current-previous)*100/previous)
+}
+
+func renderImageTable(w io.Writer, data [][]string, group string) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Namespace", "Resource", "Container", group, "First seen", "Avg CPU", "Avg MEM", "Change"})
+	for _, v := range data {
+		table.Append(v)
+	}
+	table.Render()
+}
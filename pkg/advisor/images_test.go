@@ -0,0 +1,146 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkloadPodRegex(t *testing.T) {
+	deployment := func(name string) appsv1.Deployment {
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	cronjob := batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup"}}
+
+	tests := []struct {
+		name  string
+		regex string
+		match []string
+		other []string
+	}{
+		{
+			name:  "deployment app",
+			regex: deploymentPodRegex(deployment("app")),
+			match: []string{"app-7b9c8d6f5-k2l4m"},
+			other: []string{"app-api-7b9c8d6f5-k2l4m", "app-api-5d8f7c9b6-x2x4z"},
+		},
+		{
+			name:  "deployment app-api",
+			regex: deploymentPodRegex(deployment("app-api")),
+			match: []string{"app-api-5d8f7c9b6-x2x4z"},
+			other: []string{"app-7b9c8d6f5-k2l4m"},
+		},
+		{
+			name:  "deployment backup",
+			regex: deploymentPodRegex(deployment("backup")),
+			match: []string{"backup-7b9c8d6f5-k2l4m"},
+			other: []string{"backup-28000000-x2x4z"},
+		},
+		{
+			name:  "cronjob backup",
+			regex: cronJobPodRegex(cronjob),
+			match: []string{"backup-28000000-x2x4z"},
+			other: []string{"backup-7b9c8d6f5-k2l4m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prometheus anchors the regular expressions of the label matchers
+			pattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", tt.regex))
+			for _, pod := range tt.match {
+				if !pattern.MatchString(pod) {
+					t.Errorf("%s does not match pod %s", tt.regex, pod)
+				}
+			}
+			for _, pod := range tt.other {
+				if pattern.MatchString(pod) {
+					t.Errorf("%s matches pod %s of another workload", tt.regex, pod)
+				}
+			}
+		})
+	}
+}
+
+// podSeries is the usage of a container in a fake prometheus
+type podSeries struct {
+	namespace string
+	pod       string
+	container string
+	value     float64
+}
+
+// fakeUsagePrometheus answers the queries with the series of the pods matching the namespace and pod label matchers of the query
+func fakeUsagePrometheus(t *testing.T, series []podSeries) *promClient {
+	matchers := regexp.MustCompile(`namespace="([^"]*)", pod=~"([^"]*)"`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Error(err)
+		}
+		result := []string{}
+		if match := matchers.FindStringSubmatch(r.Form.Get("query")); match != nil {
+			pod := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", match[2]))
+			for _, s := range series {
+				if s.namespace == match[1] && pod.MatchString(s.pod) {
+					result = append(result, fmt.Sprintf(`{"metric": {"namespace": "%s", "pod": "%s", "container": "%s"}, "value": [1600000000, "%g"]}`, s.namespace, s.pod, s.container, s.value))
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [%s]}}`, strings.Join(result, ","))
+	}))
+	t.Cleanup(server.Close)
+	client, err := makePrometheusClientForURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPodUsageSameContainerName(t *testing.T) {
+	series := []podSeries{
+		{namespace: "shop", pod: "cart-7b9c8d6f5-k2l4m", container: "app", value: 1},
+		{namespace: "shop", pod: "cart-7b9c8d6f5-x2x4z", container: "app", value: 2},
+		{namespace: "shop", pod: "checkout-5d8f7c9b6-k2l4m", container: "app", value: 8},
+		{namespace: "staging", pod: "cart-7b9c8d6f5-k2l4m", container: "app", value: 16},
+	}
+	o := &Options{
+		Window:             "7d",
+		Quantile:           "0.95",
+		RequestAggregation: aggregationQuantile,
+		LimitAggregation:   aggregationMax,
+		CPUMetric:          cpuUsageSeries,
+		MemMetric:          memoryUsageSeries,
+		promClient:         fakeUsagePrometheus(t, series),
+	}
+
+	tests := []struct {
+		namespace  string
+		deployment string
+		want       float64
+	}{
+		{namespace: "shop", deployment: "cart", want: 2},
+		{namespace: "shop", deployment: "checkout", want: 8},
+		{namespace: "staging", deployment: "cart", want: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace+"/"+tt.deployment, func(t *testing.T) {
+			deployment := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: tt.deployment}}
+			usage, err := o.podUsage(context.Background(), deployment.Namespace, deploymentPodRegex(deployment))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(usage.RequestCPU) != 1 || usage.RequestCPU["app"] != tt.want {
+				t.Errorf("request cpu = %v, want only app with %g", usage.RequestCPU, tt.want)
+			}
+		})
+	}
+}
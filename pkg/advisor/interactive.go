@@ -0,0 +1,61 @@
+package advisor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// reviewRecommendations shows the changes one by one and returns the ones accepted by the user.
+// Only the suggestions that would be patched are asked, the others are outside of the thresholds.
+func (o *Options) reviewRecommendations(in io.Reader, w io.Writer) ([]Recommendation, error) {
+	accepted := []Recommendation{}
+	reader := bufio.NewReader(in)
+	color := term.IsTerminal(int(os.Stderr.Fd()))
+	all := false
+	for _, r := range o.recommendations {
+		if r.Workload.Kind == "pod" || containerPatch(r, o.exceedsThresholds) == nil {
+			continue
+		}
+		if all {
+			accepted = append(accepted, r)
+			continue
+		}
+
+		err := renderDiff(w, []Recommendation{r}, color)
+		if err != nil {
+			return nil, err
+		}
+	prompt:
+		for {
+			fmt.Fprintf(w, "Apply this change? [y]es, [n]o, [a]ll remaining, [q]uit: ")
+			answer, err := reader.ReadString('\n')
+			// the end of the input stops the review like quit
+			if err == io.EOF && answer == "" {
+				fmt.Fprintln(w)
+				return accepted, nil
+			}
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("could not read the answer: %v", err)
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				accepted = append(accepted, r)
+				break prompt
+			case "n", "no", "":
+				break prompt
+			case "a", "all":
+				accepted = append(accepted, r)
+				all = true
+				break prompt
+			case "q", "quit":
+				return accepted, nil
+			}
+		}
+	}
+	return accepted, nil
+}
@@ -2,36 +2,102 @@ package advisor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/olekukonko/tablewriter"
+	prommodel "github.com/prometheus/common/model"
+	"golang.org/x/term"
+	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-func Run(o *Options) error {
-	var err error
-	o.client, err = newClientSet()
+// Analyze collects the usage of the workloads selected by the options and returns the suggestions per container.
+// The suggestions found so far are returned together with the error when the context is done before all namespaces
+// are analyzed, or when some workloads could not be analyzed and --fail-fast is not set. Other errors return none.
+// With --output jsonl the suggestions are streamed as they are found and none are returned.
+func Analyze(ctx context.Context, o *Options) ([]Recommendation, error) {
+	err := o.validate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	o.promClient, err = makePrometheusClientForCluster()
+	// the results of a previous analysis with the same options are dropped
+	o.recommendations, o.entries, o.imageRows = nil, nil, nil
+	o.diagnostics, o.drifts, o.overBudget, o.rolling = nil, nil, nil, nil
+	o.totalCPUSave, o.totalMemSave, o.hiddenContainers, o.partial = 0, 0, 0, false
+	o.totals = savings{}
+	o.wellSizedContainers = 0
+	o.analyzed, o.noMetrics, o.workloadErrors = make(map[string]int), make(map[string]bool), nil
+	o.namespaceWorkloads, o.namespaceTotals = make(map[string]int), make(map[string]namespaceTotal)
+	o.skipped, o.skippedContainers = nil, make(map[string]bool)
+	o.warned = make(map[string]bool)
+	o.streamed, o.streamedWorkloads, o.streamedSavings = 0, nil, make(map[Workload]savings)
+	o.podMetrics = nil
+
+	o.client, err = o.newClientSet()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if o.ClusterName == "" {
+		o.ClusterName, err = o.currentContext()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// metrics-server is read through the kubernetes api
+	if o.Backend != backendMetricsServer {
+		err = o.setupPrometheus(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
-	ctx := context.Background()
 
-	if o.NamespaceSelector != "" {
+	if o.FromFile != "" {
+		_, namespace, err := o.findConfig()
+		if err != nil {
+			return nil, err
+		}
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		o.fileDeployments, err = loadDeployments(o.FromFile, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if len(o.fileDeployments) == 0 {
+			return nil, fmt.Errorf("could not find deployments from %s", o.FromFile)
+		}
+		o.Namespaces = strings.Join(o.fileNamespaces(), ",")
+	} else if o.AllNamespaces || o.NamespaceSelector != "" {
 		namespaces, err := o.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
 			LabelSelector: o.NamespaceSelector,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		strNamespace := []string{}
@@ -42,233 +108,1614 @@ func Run(o *Options) error {
 	} else if o.NamespaceInput != "" {
 		o.Namespaces = o.NamespaceInput
 	} else {
-		_, namespace, err := findConfig()
+		_, namespace, err := o.findConfig()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		o.Namespaces = namespace
 	}
 
-	fmt.Printf("Namespaces: %s\n", o.Namespaces)
-	fmt.Printf("Quantile: %s\n", o.Quantile)
-	fmt.Printf("Limit margin: %s\n", o.LimitMargin)
+	if o.NamespaceExclude != "" {
+		included := []string{}
+		for _, namespace := range strings.Split(o.Namespaces, ",") {
+			if !o.namespaceExcluded(namespace) {
+				included = append(included, namespace)
+			}
+		}
+		if len(included) == 0 {
+			return nil, fmt.Errorf("all namespaces are excluded by '%s'", o.NamespaceExclude)
+		}
+		o.Namespaces = strings.Join(included, ",")
+	}
 
-	data := [][]string{}
+	var reference *prometheusMetrics
+	if o.ReferenceDeployment != "" {
+		reference, err = o.referenceMetrics(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	totalCPUSave := float64(0.00)
-	totalMemSave := float64(0.00)
+	o.namespaceCPUSave = make(map[string]float64)
+	o.namespaceMemSave = make(map[string]float64)
+	workloadOptions := metav1.ListOptions{
+		LabelSelector: o.Selector,
+	}
 	for _, namespace := range strings.Split(o.Namespaces, ",") {
-		deployments, err := o.client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		err = o.analyzeNamespace(ctx, namespace, reference, workloadOptions)
+		if o.partial {
+			break
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
 
-		for _, deployment := range deployments.Items {
-			selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
-			if err != nil {
-				return err
-			}
+	if o.partial {
+		return o.recommendations, fmt.Errorf("analysis stopped before all namespaces were analyzed: %v", ctx.Err())
+	}
+	if len(o.workloadErrors) > 0 {
+		return o.recommendations, fmt.Errorf("%d workloads could not be analyzed", len(o.workloadErrors))
+	}
+	return o.recommendations, nil
+}
 
-			replicasets, err := o.client.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
-				LabelSelector: selector.String(),
-			})
-			if err != nil {
-				return err
-			}
+// namespaceObjects are the objects of a namespace its workloads are checked against
+type namespaceObjects struct {
+	pdbs      []policyv1.PodDisruptionBudget
+	quotas    []v1.ResourceQuota
+	hpas      []autoscalingv2beta2.HorizontalPodAutoscaler
+	reference *prometheusMetrics
+}
 
-			replicaset, err := findReplicaset(replicasets, deployment)
-			if err != nil {
-				return err
-			}
+// analyzeNamespace analyzes the workloads of the namespace. Every error goes through handleError, a tolerated error
+// skips the namespace or the workload and the other errors stop the analysis.
+func (o *Options) analyzeNamespace(ctx context.Context, namespace string, reference *prometheusMetrics, workloadOptions metav1.ListOptions) error {
+	resource := fmt.Sprintf("namespace %s", namespace)
+	objects := namespaceObjects{reference: reference}
+	var err error
+	objects.pdbs, err = o.listPDBs(ctx, namespace)
+	if err != nil {
+		return o.handleError(ctx, resource, err)
+	}
 
-			selector, err = metav1.LabelSelectorAsSelector(replicaset.Spec.Selector)
-			if err != nil {
-				return err
-			}
+	objects.quotas = o.listQuotas(ctx, namespace)
 
-			final, err := o.findPods(ctx, deployment.Namespace, selector.String())
-			if err != nil {
-				return err
-			}
+	objects.hpas, err = o.listHPAs(ctx, namespace)
+	if err != nil {
+		return o.handleError(ctx, resource, err)
+	}
+
+	var deployments *appsv1.DeploymentList
+	if o.FromFile != "" {
+		deployments, err = o.listFileDeployments(namespace)
+	} else {
+		deployments, err = o.client.AppsV1().Deployments(namespace).List(ctx, workloadOptions)
+	}
+	if err != nil {
+		return o.handleError(ctx, resource, err)
+	}
 
-			cpuSave := float64(0.00)
-			memSave := float64(0.00)
-			data, cpuSave, memSave = o.analyzeDeployment(data, deployment, final)
-			totalCPUSave += cpuSave
-			totalMemSave += memSave
+	for _, deployment := range deployments.Items {
+		if !o.nameMatches(deployment.Name) {
+			continue
+		}
+		if o.optedOut(deployment.ObjectMeta, "deployment") {
+			continue
+		}
+		// usage during a rollout mixes pods of the old and new replicasets
+		if o.FromFile == "" && !o.IncludeRolling && deployment.Status.UpdatedReplicas != deployment.Status.Replicas {
+			glog.V(2).Infof("skipping deployment %s/%s, rollout in progress", deployment.Namespace, deployment.Name)
+			o.rolling = append(o.rolling, fmt.Sprintf("%s/%s", deployment.Namespace, deployment.Name))
+			continue
 		}
 
-		statefulSets, err := o.client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
-		if err != nil {
+		err = o.analyzeDeploymentUsage(ctx, deployment, objects)
+		if err = o.handleError(ctx, fmt.Sprintf("%s deployment/%s", namespace, deployment.Name), err); err != nil {
 			return err
 		}
+	}
 
-		for _, statefulSet := range statefulSets.Items {
-			selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
-			if err != nil {
-				return err
-			}
+	// only deployments are read from the files
+	if o.FromFile != "" {
+		return nil
+	}
 
-			final, err := o.findPods(ctx, statefulSet.Namespace, selector.String())
-			if err != nil {
-				return err
-			}
+	statefulSets, err := o.client.AppsV1().StatefulSets(namespace).List(ctx, workloadOptions)
+	if err != nil {
+		return o.handleError(ctx, resource, err)
+	}
 
-			cpuSave := float64(0.00)
-			memSave := float64(0.00)
-			data, cpuSave, memSave = o.analyzeStatefulset(data, statefulSet, final)
-			totalCPUSave += cpuSave
-			totalMemSave += memSave
+	for _, statefulSet := range statefulSets.Items {
+		if !o.nameMatches(statefulSet.Name) {
+			continue
+		}
+		if o.optedOut(statefulSet.ObjectMeta, "statefulset") {
+			continue
 		}
 
-		daemonSets, err := o.client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
-		if err != nil {
+		err = o.analyzeStatefulSetUsage(ctx, statefulSet, objects)
+		if err = o.handleError(ctx, fmt.Sprintf("%s statefulset/%s", namespace, statefulSet.Name), err); err != nil {
 			return err
 		}
+	}
 
-		for _, daemonSets := range daemonSets.Items {
-			selector, err := metav1.LabelSelectorAsSelector(daemonSets.Spec.Selector)
-			if err != nil {
-				return err
-			}
+	daemonSets, err := o.client.AppsV1().DaemonSets(namespace).List(ctx, workloadOptions)
+	if err != nil {
+		return o.handleError(ctx, resource, err)
+	}
 
-			final, err := o.findPods(ctx, daemonSets.Namespace, selector.String())
-			if err != nil {
-				return err
-			}
+	for _, daemonSet := range daemonSets.Items {
+		if !o.nameMatches(daemonSet.Name) {
+			continue
+		}
+		if o.optedOut(daemonSet.ObjectMeta, "daemonset") {
+			continue
+		}
 
-			cpuSave := float64(0.00)
-			memSave := float64(0.00)
-			data, cpuSave, memSave = o.analyzeDaemonSet(data, daemonSets, final)
-			totalCPUSave += cpuSave
-			totalMemSave += memSave
+		err = o.analyzeDaemonSetUsage(ctx, daemonSet, objects)
+		if err = o.handleError(ctx, fmt.Sprintf("%s daemonset/%s", namespace, daemonSet.Name), err); err != nil {
+			return err
 		}
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Namespace", "Resource", "Container", "Request CPU (spec)", "Request MEM (spec)", "Limit CPU (spec)", "Limit MEM (spec)"})
-	for _, v := range data {
-		table.Append(v)
+	// batch/v1 cronjobs are not served by clusters older than 1.21, and the user may not be allowed to list them.
+	// The cronjobs are skipped then, the other workloads of the namespace are still analyzed.
+	cronJobs, err := o.client.BatchV1().CronJobs(namespace).List(ctx, workloadOptions)
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		o.warnOnce("cronjobs", fmt.Sprintf("could not list the cronjobs, they are not analyzed: %v", err))
+		cronJobs, err = &batchv1.CronJobList{}, nil
+	}
+	if err != nil {
+		return o.handleError(ctx, resource, err)
 	}
-	table.Render()
 
-	fmt.Printf("Total savings:\n")
+	for _, cronJob := range cronJobs.Items {
+		if !o.nameMatches(cronJob.Name) {
+			continue
+		}
+		if o.optedOut(cronJob.ObjectMeta, "cronjob") {
+			continue
+		}
 
-	totalMem := int64(totalMemSave)
-	totalMemStr := ByteCountSI(totalMem)
-	if totalMem < 0 {
-		totalMem *= -1
-		totalMemStr = ByteCountSI(totalMem)
-		totalMemStr = fmt.Sprintf("-%s", totalMemStr)
+		err = o.analyzeCronJobUsage(ctx, cronJob, objects)
+		if err = o.handleError(ctx, fmt.Sprintf("%s cronjob/%s", namespace, cronJob.Name), err); err != nil {
+			return err
+		}
 	}
-	fmt.Printf("You could save %.2f vCPUs and %s Memory by changing the settings\n", totalCPUSave, totalMemStr)
 
-	return nil
-}
+	if !o.IncludeBarePods {
+		return nil
+	}
 
-func currentValue(resources v1.ResourceRequirements, method string, resource v1.ResourceName, current int, format apresource.Format) (float64, string) {
-	curSaving := float64(float64(current) * 1000 * 1000)
-	if format == apresource.DecimalSI {
-		curSaving = float64(float64(current) / 1000)
+	pods, err := o.client.CoreV1().Pods(namespace).List(ctx, workloadOptions)
+	if err != nil {
+		return o.handleError(ctx, resource, err)
 	}
 
-	if method == "limit" {
-		val, ok := resources.Limits[resource]
-		if ok {
-			return val.AsApproximateFloat64() - curSaving, val.String()
+	for _, pod := range pods.Items {
+		if !o.nameMatches(pod.Name) || managedPod(pod) {
+			continue
+		}
+		if o.optedOut(pod.ObjectMeta, "pod") {
+			continue
 		}
+
+		err = o.analyzePodUsage(ctx, pod, objects)
+		if err = o.handleError(ctx, fmt.Sprintf("%s pod/%s", namespace, pod.Name), err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Options) analyzeDeploymentUsage(ctx context.Context, deployment appsv1.Deployment, objects namespaceObjects) error {
+	var final prometheusMetrics
+	var err error
+	// deployments from files have no replicasets, their usage is found by the pod names
+	if o.FromFile != "" || (o.IncludeScaledDown && *deployment.Spec.Replicas == 0) {
+		final, err = o.podNameMetrics(ctx, deployment)
 	} else {
-		val, ok := resources.Requests[resource]
-		if ok {
-			return val.AsApproximateFloat64() - curSaving, val.String()
+		final, err = o.deploymentMetrics(ctx, deployment)
+	}
+	if err != nil {
+		return err
+	}
+	if objects.reference != nil {
+		final = objects.reference.apply(final)
+	}
+
+	if o.ByImage || o.ByLabel != "" {
+		usages, err := o.queryImageUsage(ctx, deployment)
+		if err != nil {
+			return err
 		}
+		o.imageRows = analyzeImages(o.imageRows, deployment, usages)
 	}
-	return -1 * curSaving, "<nil>"
+
+	start := len(o.entries)
+	entries, cpuSave, memSave := o.analyzeDeployment(o.entries, deployment, objects.hpas, final)
+	o.checkWorkload(entries, start, objects, deployment.Namespace, fmt.Sprintf("deployment/%s", deployment.Name), deployment.Spec.Template, *deployment.Spec.Replicas, cpuSave, memSave)
+	return nil
 }
 
-func (o *Options) analyzeDaemonSet(data [][]string, daemonset appsv1.DaemonSet, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range daemonset.Spec.Template.Spec.Containers {
-		reqCpu := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCpu := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
+func (o *Options) analyzeStatefulSetUsage(ctx context.Context, statefulSet appsv1.StatefulSet, objects namespaceObjects) error {
+	selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	final, err := o.findPods(ctx, &statefulSet, selector.String(), statefulSet.Status.UpdateRevision)
+	if err != nil {
+		return err
+	}
 
-		reqCpuSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCpu, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCpu, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCpuSave * float64(daemonset.Status.DesiredNumberScheduled)
-		totalMemSavings += reqMemSave * float64(daemonset.Status.DesiredNumberScheduled)
-		data = append(data, []string{
-			daemonset.Namespace,
-			fmt.Sprintf("daemonset/%s", daemonset.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCpu, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCpu, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+	start := len(o.entries)
+	entries, cpuSave, memSave := o.analyzeStatefulset(o.entries, statefulSet, final)
+	o.checkWorkload(entries, start, objects, statefulSet.Namespace, fmt.Sprintf("statefulset/%s", statefulSet.Name), statefulSet.Spec.Template, *statefulSet.Spec.Replicas, cpuSave, memSave)
+	return nil
+}
+
+func (o *Options) analyzeDaemonSetUsage(ctx context.Context, daemonSet appsv1.DaemonSet, objects namespaceObjects) error {
+	selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	final, err := o.findPods(ctx, &daemonSet, selector.String(), "")
+	if err != nil {
+		return err
 	}
-	return data, totalCPUSavings, totalMemSavings
+
+	start := len(o.entries)
+	entries, cpuSave, memSave := o.analyzeDaemonSet(o.entries, daemonSet, final)
+	o.checkWorkload(entries, start, objects, daemonSet.Namespace, fmt.Sprintf("daemonset/%s", daemonSet.Name), daemonSet.Spec.Template, daemonSet.Status.CurrentNumberScheduled, cpuSave, memSave)
+	return nil
 }
 
-func (o *Options) analyzeStatefulset(data [][]string, statefulset appsv1.StatefulSet, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range statefulset.Spec.Template.Spec.Containers {
-		reqCpu := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCpu := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
+func (o *Options) analyzeCronJobUsage(ctx context.Context, cronJob batchv1.CronJob, objects namespaceObjects) error {
+	final, err := o.cronJobMetrics(ctx, cronJob)
+	if err != nil {
+		return err
+	}
 
-		reqCpuSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCpu, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCpu, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCpuSave * float64(*statefulset.Spec.Replicas)
-		totalMemSavings += reqMemSave * float64(*statefulset.Spec.Replicas)
-		data = append(data, []string{
-			statefulset.Namespace,
-			fmt.Sprintf("statefulset/%s", statefulset.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCpu, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCpu, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+	start := len(o.entries)
+	entries, cpuSave, memSave := o.analyzeCronJob(o.entries, cronJob, final)
+	o.checkWorkload(entries, start, objects, cronJob.Namespace, fmt.Sprintf("cronjob/%s", cronJob.Name), cronJob.Spec.JobTemplate.Spec.Template, 1, cpuSave, memSave)
+	return nil
+}
+
+func (o *Options) analyzePodUsage(ctx context.Context, pod v1.Pod, objects namespaceObjects) error {
+	output, err := o.queryPrometheusForPod(ctx, o.promClient, pod)
+	if err != nil {
+		return err
 	}
-	return data, totalCPUSavings, totalMemSavings
+	final := o.aggregateMetrics([]prometheusMetrics{output})
+
+	start := len(o.entries)
+	entries, cpuSave, memSave := o.analyzePod(o.entries, pod, final)
+	o.checkWorkload(entries, start, objects, pod.Namespace, fmt.Sprintf("pod/%s", pod.Name), v1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec}, 1, cpuSave, memSave)
+	return nil
 }
 
-func (o *Options) analyzeDeployment(data [][]string, deployment appsv1.Deployment, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range deployment.Spec.Template.Spec.Containers {
-		reqCpu := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCpu := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
+// checkWorkload checks the entries of the workload from start against the objects of its namespace and adds its savings
+func (o *Options) checkWorkload(entries []tableEntry, start int, objects namespaceObjects, namespace string, resource string, template v1.PodTemplateSpec, replicas int32, cpuSave float64, memSave float64) {
+	entries = o.checkPDB(entries, start, objects.pdbs, namespace, resource, template, replicas, cpuSave, memSave)
+	entries = o.checkQuota(entries, start, objects.quotas, namespace, resource, cpuSave, memSave)
+	o.entries = o.setWasteScore(entries, start, cpuSave, memSave)
+	o.checkBudget(namespace, resource, cpuSave, memSave)
+	o.addSavings(namespace, cpuSave, memSave)
+}
 
-		reqCpuSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCpu, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCpu, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCpuSave * float64(*deployment.Spec.Replicas)
-		totalMemSavings += reqMemSave * float64(*deployment.Spec.Replicas)
-		data = append(data, []string{
-			deployment.Namespace,
-			fmt.Sprintf("deployment/%s", deployment.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCpu, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCpu, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+// handleError records the error of the resource and returns nil when the analysis goes on without it. The error
+// returned stops the analysis, after the deadline is exceeded o.partial is set and the results found so far are kept.
+func (o *Options) handleError(ctx context.Context, resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		o.partial = true
+		return ctx.Err()
+	}
+	if o.tolerate(resource, err) {
+		return nil
+	}
+	return err
+}
+
+// tolerate records the error of the workload and tells if the analysis continues without it, --fail-fast stops at the first error
+func (o *Options) tolerate(resource string, err error) bool {
+	if o.FailFast {
+		return false
+	}
+	glog.V(1).Infof("%s: %v", resource, err)
+	o.workloadErrors = append(o.workloadErrors, fmt.Sprintf("%s: %v", resource, err))
+	return true
+}
+
+// Run analyzes the workloads and prints the suggestions in the requested output format
+func Run(o *Options) error {
+	if o.OutputFile == "" {
+		_, err := o.run(os.Stdout)
+		return err
+	}
+
+	// the report is written next to --output-file and renamed over it once complete, a failed run keeps the previous report
+	file, err := ioutil.TempFile(filepath.Dir(o.OutputFile), "."+filepath.Base(o.OutputFile)+".")
+	if err != nil {
+		return fmt.Errorf("could not create output file: %v", err)
+	}
+	reported, runErr := o.run(file)
+	err = file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("could not write output file: %v", err)
+	}
+	if !reported {
+		os.Remove(file.Name())
+		return runErr
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err == nil {
+		err = os.Rename(file.Name(), o.OutputFile)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("could not write output file: %v", err)
+	}
+	return runErr
+}
+
+// run writes the report to out, reported tells if the report was written even when an error is returned,
+// e.g. for the workloads that could not be analyzed
+func (o *Options) run(out io.Writer) (reported bool, err error) {
+	ctx := context.Background()
+	if o.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Deadline)
+		defer cancel()
+	}
+
+	// the recommendations are written while analyzing instead of being collected
+	if o.Output == outputJSONL {
+		o.stream = json.NewEncoder(out)
+	}
+
+	recommendations, err := Analyze(ctx, o)
+	if err != nil && !o.partial && len(o.workloadErrors) == 0 {
+		return false, err
+	}
+
+	// machine readable formats own the output, everything else is informational
+	info := out
+	if o.machineOutput() {
+		info = os.Stderr
+	}
+
+	fmt.Fprintf(info, "Namespaces: %s\n", o.Namespaces)
+	if o.Backend == backendMetricsServer {
+		fmt.Fprintf(info, "Usage: current values from metrics-server, the suggestions are less accurate than with history\n")
+	} else if o.since.IsZero() {
+		fmt.Fprintf(info, "Window: %s\n", o.Window)
+	} else {
+		fmt.Fprintf(info, "Range: %s - %s\n", o.since.Format(time.RFC3339), o.until.Format(time.RFC3339))
+	}
+	if !o.at.IsZero() {
+		fmt.Fprintf(info, "At: %s\n", o.at.Format(time.RFC3339))
+	}
+	if o.RecentWindow != "" {
+		fmt.Fprintf(info, "Request blend: %s weighted %.2f, %s weighted %.2f\n", o.RecentWindow, o.RecentWeight, o.HistoryWindow, 1-o.RecentWeight)
+	}
+	fmt.Fprintf(info, "Request strategy: %s\n", o.RequestStrategy)
+	if o.Profile != "" {
+		fmt.Fprintf(info, "Profile: %s\n", o.Profile)
+	}
+	fmt.Fprintf(info, "Quantile: %s\n", o.Quantile)
+	fmt.Fprintf(info, "Request aggregation: %s\n", o.RequestAggregation)
+	fmt.Fprintf(info, "Limit aggregation: %s\n", o.LimitAggregation)
+	fmt.Fprintf(info, "Limit margin: %.2f\n", o.LimitMargin)
+
+	if o.ReferenceDeployment != "" {
+		fmt.Fprintf(info, "Reference deployment: %s\n", o.ReferenceDeployment)
+	}
+
+	switch o.Output {
+	case outputKubecostCSV:
+		err = renderKubecostCSV(out, o.ClusterName, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputCSV:
+		err = renderCSV(out, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputJSON:
+		err = renderJSON(out, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputYAML:
+		err = renderYAML(out, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputVPA:
+		err = renderVPA(out, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputJSONL:
+		err = o.stream.Encode(o.streamSummary())
+		if err != nil {
+			return false, err
+		}
+	case outputHTML:
+		err = o.renderHTML(out, recommendations)
+		if err != nil {
+			return false, err
+		}
+	case outputDiff:
+		err = renderDiff(out, recommendations, o.OutputFile == "" && term.IsTerminal(int(os.Stdout.Fd())))
+		if err != nil {
+			return false, err
+		}
+	default:
+		table := tablewriter.NewWriter(out)
+		header := []string{"Namespace", "Resource", "Container", "Request CPU (spec)", "Request MEM (spec)", "Limit CPU (spec)", "Limit MEM (spec)", "CPU Savings", "MEM Savings"}
+		if o.Output == outputWide {
+			header = append(header, "QoS", "PDB", "Quota")
+		}
+		if o.WasteScore {
+			header = append(header, "Waste score")
+		}
+		table.SetHeader(header)
+		for _, v := range o.tableRows(o.entries) {
+			table.Append(v)
+		}
+		table.Render()
+
+		if o.ByImage {
+			fmt.Fprintf(out, "Usage by image:\n")
+			renderImageTable(out, o.imageRows, "Image")
+		}
+		if o.ByLabel != "" {
+			fmt.Fprintf(out, "Usage by pod label %s:\n", o.ByLabel)
+			renderImageTable(out, o.imageRows, o.ByLabel)
+		}
+	}
+
+	o.printDiagnostics(info)
+
+	o.printSummary(info)
+
+	if len(o.rolling) > 0 {
+		fmt.Fprintf(info, "Skipped deployments with a rollout in progress (use --include-rolling to analyze them): %s\n", strings.Join(o.rolling, ", "))
+	}
+
+	if o.partial {
+		fmt.Fprintf(info, "Deadline of %s exceeded, the results are partial\n", o.Deadline)
+	}
+
+	if o.Apply && !o.partial {
+		recommendations := o.recommendations
+		if o.Interactive {
+			recommendations, err = o.reviewRecommendations(os.Stdin, info)
+			if err != nil {
+				return true, err
+			}
+			fmt.Fprintf(info, "Accepted %d of %d suggestions\n", len(recommendations), len(o.recommendations))
+		}
+		err = o.applyRecommendations(ctx, info, recommendations)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if o.NamespaceSummary {
+		o.printNamespaceSummary(info)
+	}
+
+	fmt.Fprintf(info, "Total savings:\n")
+	if len(o.envProfiles) == 0 {
+		o.printSavings(info, o.totals)
+		o.printCost(info, o.totalCPUSave, o.totalMemSave)
+	}
+	for _, profile := range o.envProfiles {
+		fmt.Fprintf(info, "%s (%.2fx): ", profile, o.envMultipliers[profile])
+		o.printSavings(info, o.profileSavings[profile])
+		o.printCost(info, o.profileCPUSave[profile], o.profileMemSave[profile])
+	}
+	if len(o.envProfiles) == 0 && len(o.namespaceCPUSave) > 1 && (o.CPUCost > 0 || o.MemCost > 0) {
+		fmt.Fprintf(info, "Savings per namespace:\n")
+		namespaces := []string{}
+		for namespace := range o.namespaceCPUSave {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			fmt.Fprintf(info, "  %s: %.2f per month\n", namespace, o.monthlyCost(o.namespaceCPUSave[namespace], o.namespaceMemSave[namespace]))
+		}
+	}
+
+	if len(o.overBudget) > 0 {
+		fmt.Fprintf(info, "Workloads with savings over the budget:\n")
+		for _, workload := range o.overBudget {
+			fmt.Fprintf(info, "  %s\n", workload)
+		}
+	}
+
+	if o.MetricsPush != "" && !o.partial {
+		err = o.pushMetrics(ctx)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if o.WebhookURL != "" && !o.partial {
+		err = o.notifyWebhook(ctx)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if len(o.workloadErrors) > 0 {
+		fmt.Fprintf(info, "Workloads that could not be analyzed:\n")
+		for _, workloadError := range o.workloadErrors {
+			fmt.Fprintf(info, "  %s\n", workloadError)
+		}
+	}
+
+	if o.FailOnDrift && len(o.drifts) > 0 {
+		fmt.Fprintf(info, "Containers drifting more than %.2fx from the suggestion:\n", o.DriftThreshold)
+		for _, drift := range o.drifts {
+			fmt.Fprintf(info, "  %s\n", drift)
+		}
+		return true, fmt.Errorf("%d containers drifted from the suggested requests", len(o.drifts))
+	}
+	if len(o.overBudget) > 0 {
+		return true, fmt.Errorf("%d workloads could save more than the budget allows", len(o.overBudget))
+	}
+	if len(o.workloadErrors) > 0 {
+		return true, fmt.Errorf("%d workloads could not be analyzed", len(o.workloadErrors))
+	}
+	if o.partial {
+		return true, fmt.Errorf("deadline of %s exceeded before all namespaces were analyzed", o.Deadline)
+	}
+	return true, nil
+}
+
+// setupPrometheus configures the prometheus client and checks that prometheus answers
+func (o *Options) setupPrometheus(ctx context.Context) error {
+	var err error
+	o.promClient, err = o.makePrometheusClientForCluster(o.PrometheusURL)
+	if err != nil {
+		return err
+	}
+
+	if o.Backend == backendThanos {
+		o.promClient.params = url.Values{
+			"dedup":            []string{strconv.FormatBool(o.Dedup)},
+			"partial_response": []string{strconv.FormatBool(o.PartialResponse)},
+		}
+	}
+
+	o.promClient.timeout = o.Timeout
+	if o.QueryRate > 0 {
+		o.promClient.limiter = rate.NewLimiter(rate.Limit(o.QueryRate), 1)
+	}
+	o.promClient.username = o.PrometheusUsername
+	o.promClient.password = o.PrometheusPassword
+	o.promClient.token = o.PrometheusToken
+	if o.PrometheusTokenFile != "" {
+		token, err := ioutil.ReadFile(o.PrometheusTokenFile)
+		if err != nil {
+			return fmt.Errorf("could not read prometheus token file: %v", err)
+		}
+		o.promClient.token = strings.TrimSpace(string(token))
+	}
+
+	if o.CacheDir != "" && !o.NoCache {
+		o.promClient.cache, err = newQueryCache(o.CacheDir, o.CacheTTL, o.promClient.URL("", nil).String())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = o.checkPrometheus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if o.RequireMetrics {
+		err = o.checkRequiredMetrics(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespaceExcluded tells if the namespace matches any of the --namespace-exclude glob patterns
+func (o *Options) namespaceExcluded(namespace string) bool {
+	for _, pattern := range strings.Split(o.NamespaceExclude, ",") {
+		if matched, _ := path.Match(strings.TrimSpace(pattern), namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) nameMatches(name string) bool {
+	return o.nameFilter == nil || o.nameFilter.MatchString(name)
+}
+
+// optedOut tells if the workload is skipped with the skip annotation and records the containers skipped with the
+// skip-container annotation, e.g. resource-advisor.io/skip-container: "istio-proxy,log-shipper"
+func (o *Options) optedOut(meta metav1.ObjectMeta, kind string) bool {
+	if meta.Annotations[annotationSkip] == "true" {
+		glog.V(2).Infof("skipping %s %s/%s, %s annotation", kind, meta.Namespace, meta.Name, annotationSkip)
+		o.skipped = append(o.skipped, fmt.Sprintf("%s/%s/%s", meta.Namespace, kind, meta.Name))
+		return true
+	}
+	if containers, ok := meta.Annotations[annotationSkipContainer]; ok {
+		for _, container := range strings.Split(containers, ",") {
+			o.skippedContainers[fmt.Sprintf("%s/%s/%s/%s", meta.Namespace, kind, meta.Name, strings.TrimSpace(container))] = true
+		}
+	}
+	return false
+}
+
+// containerSelected tells if the container is analyzed with the --only-containers and --exclude-containers filters
+// and the skip-container annotation of the workload
+func (o *Options) containerSelected(w Workload, name string) bool {
+	if o.skippedContainers[fmt.Sprintf("%s/%s/%s/%s", w.Namespace, w.Kind, w.Name, name)] {
+		return false
+	}
+	if o.onlyContainers != nil && !o.onlyContainers.MatchString(name) {
+		return false
+	}
+	return o.excludeContainers == nil || !o.excludeContainers.MatchString(name)
+}
+
+// containerRegexp compiles comma separated container names or regular expressions into a single expression
+func containerRegexp(input string) (*regexp.Regexp, error) {
+	if input == "" {
+		return nil, nil
+	}
+	parts := []string{}
+	for _, part := range strings.Split(input, ",") {
+		parts = append(parts, fmt.Sprintf("(?:%s)", strings.TrimSpace(part)))
+	}
+	return regexp.Compile(fmt.Sprintf("^(?:%s)$", strings.Join(parts, "|")))
+}
+
+// managedPod tells if the pod is already analyzed through its controller or is not running anymore
+func managedPod(pod v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	controller := metav1.GetControllerOf(&pod)
+	if controller == nil {
+		return false
+	}
+	switch controller.Kind {
+	case "ReplicaSet", "StatefulSet", "DaemonSet":
+		return true
+	}
+	return false
+}
+
+// printSummary tells how many workloads and containers were covered by the analysis
+func (o *Options) printSummary(w io.Writer) {
+	kinds := []string{}
+	total := 0
+	for kind, count := range o.analyzed {
+		kinds = append(kinds, fmt.Sprintf("%s %d", kind, count))
+		total += count
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintf(w, "Summary:\n")
+	if total > 0 {
+		fmt.Fprintf(w, "  Workloads analyzed: %d (%s)\n", total, strings.Join(kinds, ", "))
+	} else {
+		fmt.Fprintf(w, "  Workloads analyzed: 0\n")
+	}
+	fmt.Fprintf(w, "  Containers with suggestions: %d\n", len(o.recommendations)+o.streamed)
+	fmt.Fprintf(w, "  Containers without metrics: %d\n", len(o.noMetrics))
+	fmt.Fprintf(w, "  Containers below the savings threshold: %d\n", o.hiddenContainers)
+	if o.ChangesOnly {
+		fmt.Fprintf(w, "  Well-sized containers hidden: %d\n", o.wellSizedContainers)
+	}
+	fmt.Fprintf(w, "  Deployments skipped during a rollout: %d\n", len(o.rolling))
+	fmt.Fprintf(w, "  Workloads skipped by annotation: %d\n", len(o.skipped))
+	fmt.Fprintf(w, "  Workloads with errors: %d\n", len(o.workloadErrors))
+}
+
+func (o *Options) printSavings(w io.Writer, s savings) {
+	fmt.Fprintf(w, "You could reclaim %.2f vCPUs and %s Memory by changing the settings\n", s.ReclaimCPU, o.byteCount(int64(s.ReclaimMem)))
+	if s.AddCPU > 0 || s.AddMem > 0 {
+		fmt.Fprintf(w, "Workloads needing more would add %.2f vCPUs and %s Memory\n", s.AddCPU, o.byteCount(int64(s.AddMem)))
+		fmt.Fprintf(w, "Net change: %s vCPUs and %s Memory\n", signedCores(s.ReclaimCPU-s.AddCPU), o.signedBytes(s.ReclaimMem-s.AddMem))
+	}
+}
+
+// signedCores formats the net cpu savings, a minus sign means the requests grow
+func signedCores(cpu float64) string {
+	return fmt.Sprintf("%.2f", cpu)
+}
+
+// signedBytes formats the net memory savings, a minus sign means the requests grow
+func (o *Options) signedBytes(mem float64) string {
+	if mem < 0 {
+		return "-" + o.byteCount(int64(-mem))
+	}
+	return o.byteCount(int64(mem))
+}
+
+// addSavings records the savings of a workload, the reductions and the increases of each resource are kept apart
+func (o *Options) addSavings(namespace string, cpuSave float64, memSave float64) {
+	o.totalCPUSave += cpuSave
+	o.totalMemSave += memSave
+	o.namespaceCPUSave[namespace] += cpuSave
+	o.namespaceMemSave[namespace] += memSave
+	o.totals = o.totals.add(cpuSave, memSave)
+}
+
+// parseTimes parses --at, --since and --until, a range given with --since replaces the window before now
+func (o *Options) parseTimes() error {
+	var err error
+	o.at, o.since, o.until = time.Time{}, time.Time{}, time.Time{}
+	if o.At != "" {
+		if o.Since != "" || o.Until != "" {
+			return fmt.Errorf("--at can not be used together with --since and --until")
+		}
+		o.at, err = time.Parse(time.RFC3339, o.At)
+		if err != nil {
+			return fmt.Errorf("invalid time '%s', use RFC3339 format: %v", o.At, err)
+		}
+		return nil
+	}
+	if o.Until != "" && o.Since == "" {
+		return fmt.Errorf("--until requires --since")
+	}
+	if o.Since == "" {
+		return nil
+	}
+	if o.RequestStrategy == requestStrategyPeakHour {
+		return fmt.Errorf("request strategy %s can not be used with --since", requestStrategyPeakHour)
+	}
+	o.since, err = time.Parse(time.RFC3339, o.Since)
+	if err != nil {
+		return fmt.Errorf("invalid time '%s', use RFC3339 format: %v", o.Since, err)
+	}
+	o.until = time.Now()
+	if o.Until != "" {
+		o.until, err = time.Parse(time.RFC3339, o.Until)
+		if err != nil {
+			return fmt.Errorf("invalid time '%s', use RFC3339 format: %v", o.Until, err)
+		}
+	}
+	if !o.since.Before(o.until) {
+		return fmt.Errorf("--since must be before --until")
+	}
+	return nil
+}
+
+// monthlyCost converts the savings of cores and bytes to money with --cpu-cost and --mem-cost
+func (o *Options) monthlyCost(cpu float64, mem float64) float64 {
+	return cpu*o.CPUCost + mem/(1024*1024*1024)*o.MemCost
+}
+
+func (o *Options) printCost(w io.Writer, cpu float64, mem float64) {
+	if o.CPUCost <= 0 && o.MemCost <= 0 {
+		return
+	}
+	fmt.Fprintf(w, "Estimated savings: %.2f per month\n", o.monthlyCost(cpu, mem))
+}
+
+func (o *Options) validate() error {
+	switch o.Output {
+	case outputTable, outputWide, outputJSON, outputYAML, outputKubecostCSV, outputVPA, outputCSV, outputDiff, outputJSONL, outputHTML:
+	default:
+		return fmt.Errorf("unknown output format '%s', supported values are %s", o.Output, strings.Join([]string{outputTable, outputWide, outputJSON, outputYAML, outputKubecostCSV, outputVPA, outputCSV, outputDiff, outputJSONL, outputHTML}, ", "))
+	}
+	if o.PrometheusURL == "" && (o.PrometheusUsername != "" || o.PrometheusToken != "" || o.PrometheusTokenFile != "") {
+		return fmt.Errorf("prometheus credentials can only be used together with --prometheus-url")
+	}
+	if o.PrometheusUsername != "" && (o.PrometheusToken != "" || o.PrometheusTokenFile != "") {
+		return fmt.Errorf("use either prometheus username and password or token, not both")
+	}
+	if o.PrometheusToken != "" && o.PrometheusTokenFile != "" {
+		return fmt.Errorf("use either --prometheus-token or --prometheus-token-file, not both")
+	}
+	switch o.MetricGranularity {
+	case granularityContainer:
+	case granularityPod:
+		// the pod cgroup series have no container label, the usage is attributed to the containers later
+		if o.CPUMetric == cpuUsageSeries {
+			o.CPUMetric = podCPUUsageSeries
+		}
+		if o.MemMetric == memoryUsageSeries {
+			o.MemMetric = podMemoryUsageSeries
+		}
+		if o.ByImage || o.ByLabel != "" {
+			return fmt.Errorf("--by-image and --by-label need container level metrics")
+		}
+	default:
+		return fmt.Errorf("unknown metric granularity '%s', supported values are %s and %s", o.MetricGranularity, granularityContainer, granularityPod)
+	}
+	templates := []string{o.CPUMetric, o.MemMetric}
+	if o.GPUMetric != "" {
+		templates = append(templates, o.GPUMetric)
+	}
+	for _, template := range templates {
+		if strings.Count(template, "%s") != 1 || strings.Count(template, "%") != 1 {
+			return fmt.Errorf("metric template '%s' must contain a single %%s placeholder for the pod selector", template)
+		}
+	}
+	switch o.Backend {
+	case backendPrometheus:
+	case backendThanos:
+		if o.PrometheusURL == "" {
+			return fmt.Errorf("backend %s requires --prometheus-url pointing to thanos query", backendThanos)
+		}
+	case backendMetricsServer:
+		// metrics-server only knows the current usage, everything needing history is rejected
+		if o.Since != "" || o.At != "" || o.Peak || o.ByImage || o.ByLabel != "" || o.GPUMetric != "" || o.RequireMetrics || o.MinSamples > 0 {
+			return fmt.Errorf("backend %s has no usage history and can not be used with --since, --at, --peak, --by-image, --by-label, --gpu-metric, --require-metrics or --min-samples", backendMetricsServer)
+		}
+	default:
+		return fmt.Errorf("unknown backend '%s', supported values are %s, %s and %s", o.Backend, backendPrometheus, backendThanos, backendMetricsServer)
+	}
+	switch o.PodAggregation {
+	case podAggregationAvg, podAggregationMax, podAggregationP95:
+	default:
+		return fmt.Errorf("unknown pod aggregation '%s', supported values are %s, %s and %s", o.PodAggregation, podAggregationAvg, podAggregationMax, podAggregationP95)
+	}
+	// the range queries pool the samples of all pods
+	if o.Since != "" && o.PodAggregation != podAggregationMax {
+		return fmt.Errorf("--pod-aggregation %s can not be used with --since", o.PodAggregation)
+	}
+	if o.RequestStrategy != requestStrategyQuantile && o.RequestStrategy != requestStrategyPeakHour {
+		return fmt.Errorf("unknown request strategy '%s', supported values are %s and %s", o.RequestStrategy, requestStrategyQuantile, requestStrategyPeakHour)
+	}
+	for flag, aggregation := range map[string]string{"request-aggregation": o.RequestAggregation, "limit-aggregation": o.LimitAggregation} {
+		if _, ok := o.aggregator(aggregation); !ok {
+			return fmt.Errorf("unknown %s '%s', supported values are %s", flag, aggregation, strings.Join(aggregatorNames(), ", "))
+		}
+	}
+	if o.customAggregation() && (o.Backend == backendMetricsServer || o.RecentWindow != "") {
+		return fmt.Errorf("registered aggregators can not be used with the %s backend or --recent-window", backendMetricsServer)
+	}
+	if o.ThrottleThreshold < 0 || o.ThrottleThreshold > 1 {
+		return fmt.Errorf("throttle threshold must be between 0 and 1, got %.2f", o.ThrottleThreshold)
+	}
+	if o.ByteUnits != byteUnitsSI && o.ByteUnits != byteUnitsBinary {
+		return fmt.Errorf("unknown byte units '%s', supported values are %s and %s", o.ByteUnits, byteUnitsSI, byteUnitsBinary)
+	}
+	if o.RequestStrategy == requestStrategyPeakHour && o.RequestAggregation != aggregationQuantile {
+		return fmt.Errorf("--request-aggregation can not be used with the %s request strategy", requestStrategyPeakHour)
+	}
+	// the peaks are the highest samples of the window
+	if o.Peak && o.LimitAggregation != aggregationMax {
+		return fmt.Errorf("--peak can not be used with --limit-aggregation %s", o.LimitAggregation)
+	}
+	if o.Quantile != "" {
+		quantile, err := strconv.ParseFloat(o.Quantile, 64)
+		if err != nil || quantile < 0 || quantile > 1 {
+			return fmt.Errorf("quantile must be a number between 0 and 1, got '%s'", o.Quantile)
+		}
+	}
+	window, err := prommodel.ParseDuration(o.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window '%s': %v", o.Window, err)
+	}
+	o.window = time.Duration(window)
+	if o.RecentWindow != "" {
+		if o.HistoryWindow == "" {
+			o.HistoryWindow = o.Window
+		}
+		recent, err := prommodel.ParseDuration(o.RecentWindow)
+		if err != nil {
+			return fmt.Errorf("invalid recent window '%s': %v", o.RecentWindow, err)
+		}
+		history, err := prommodel.ParseDuration(o.HistoryWindow)
+		if err != nil {
+			return fmt.Errorf("invalid history window '%s': %v", o.HistoryWindow, err)
+		}
+		if recent >= history {
+			return fmt.Errorf("recent window %s must be shorter than the history window %s", o.RecentWindow, o.HistoryWindow)
+		}
+		if o.RecentWeight < 0 || o.RecentWeight > 1 {
+			return fmt.Errorf("recent weight must be between 0 and 1, got %.2f", o.RecentWeight)
+		}
+		if o.Since != "" || o.Backend == backendMetricsServer {
+			return fmt.Errorf("--recent-window can not be used with --since or the %s backend", backendMetricsServer)
+		}
+	} else if o.HistoryWindow != "" {
+		return fmt.Errorf("--history-window is only used together with --recent-window")
+	}
+	err = o.parseTimes()
+	if err != nil {
+		return err
+	}
+	if o.Selector != "" {
+		_, err = labels.Parse(o.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector '%s': %v", o.Selector, err)
+		}
+	}
+	o.nameFilter = nil
+	if o.NameFilter != "" {
+		o.nameFilter, err = regexp.Compile(o.NameFilter)
+		if err != nil {
+			return fmt.Errorf("invalid name filter '%s': %v", o.NameFilter, err)
+		}
+	}
+	for _, pattern := range strings.Split(o.NamespaceExclude, ",") {
+		_, err = path.Match(strings.TrimSpace(pattern), "")
+		if err != nil {
+			return fmt.Errorf("invalid namespace exclude pattern '%s': %v", pattern, err)
+		}
+	}
+	o.onlyContainers, err = containerRegexp(o.OnlyContainers)
+	if err != nil {
+		return fmt.Errorf("invalid only containers '%s': %v", o.OnlyContainers, err)
+	}
+	o.excludeContainers, err = containerRegexp(o.ExcludeContainers)
+	if err != nil {
+		return fmt.Errorf("invalid exclude containers '%s': %v", o.ExcludeContainers, err)
+	}
+	if o.DecreaseThreshold <= 0 || o.DecreaseThreshold > 100 {
+		return fmt.Errorf("decrease threshold must be between 0 and 100 percent, got %.2f", o.DecreaseThreshold)
+	}
+	if o.IncreaseThreshold < 100 || o.IncreaseThreshold > 1000 {
+		return fmt.Errorf("increase threshold must be between 100 and 1000 percent, got %.2f", o.IncreaseThreshold)
+	}
+	if o.MinSamples < 0 {
+		return fmt.Errorf("min samples must not be negative, got %d", o.MinSamples)
+	}
+	if o.Timeout < 0 || o.Deadline < 0 {
+		return fmt.Errorf("timeout and deadline must not be negative")
+	}
+	if o.CPUCost < 0 || o.MemCost < 0 {
+		return fmt.Errorf("cpu and memory costs must not be negative")
+	}
+	if o.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+	if o.ByImage && o.ByLabel != "" {
+		return fmt.Errorf("--by-image and --by-label can not be used together")
+	}
+	if o.MetricsPush != "" {
+		target, err := url.Parse(o.MetricsPush)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("metrics-push '%s' must be an URL, e.g. http://pushgateway:9091", o.MetricsPush)
+		}
+	}
+	if o.WebhookURL != "" {
+		target, err := url.Parse(o.WebhookURL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("webhook-url must be an URL, e.g. https://hooks.slack.com/services/...")
+		}
+	}
+	if o.WebhookTop < 0 {
+		return fmt.Errorf("webhook-top must not be negative")
+	}
+	if o.QueryRate < 0 {
+		return fmt.Errorf("query-rate must not be negative")
+	}
+	if o.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", o.Concurrency)
+	}
+	if o.LimitMargin < 0 {
+		return fmt.Errorf("limit margin must not be negative, got %.2f", o.LimitMargin)
+	}
+	if o.SortBy != "" && o.SortBy != sortByScore {
+		return fmt.Errorf("unknown sort '%s', supported value is %s", o.SortBy, sortByScore)
+	}
+	if o.OverUtilizedAbove < 0 {
+		return fmt.Errorf("over-utilized-above must not be negative, got %.2f", o.OverUtilizedAbove)
+	}
+	if o.DriftThreshold < 1 {
+		return fmt.Errorf("drift threshold must be at least 1, got %.2f", o.DriftThreshold)
+	}
+	o.envMultipliers = make(map[string]float64)
+	for profile, value := range o.EnvMultipliers {
+		multiplier, err := strconv.ParseFloat(value, 64)
+		if err != nil || multiplier <= 0 {
+			return fmt.Errorf("invalid multiplier '%s' for environment profile '%s'", value, profile)
+		}
+		o.envMultipliers[profile] = multiplier
+	}
+	o.envProfiles = nil
+	o.profileCPUSave = make(map[string]float64)
+	o.profileMemSave = make(map[string]float64)
+	o.profileSavings = make(map[string]savings)
+	if o.EnvProfile != "" {
+		for _, profile := range strings.Split(o.EnvProfile, ",") {
+			if _, ok := o.envMultipliers[profile]; !ok {
+				return fmt.Errorf("environment profile '%s' has no multiplier defined in env-multipliers", profile)
+			}
+			o.envProfiles = append(o.envProfiles, profile)
+		}
+	}
+	if o.Interactive && o.OutputFile != "" {
+		return fmt.Errorf("interactive can not be used together with --output-file, the review needs the terminal")
+	}
+	// the accepted suggestions are applied at the end of the review
+	if o.Interactive {
+		o.Apply = true
+	}
+	if o.NamespaceSummary && len(o.envProfiles) > 0 {
+		return fmt.Errorf("namespace-summary can not be used together with environment profiles")
+	}
+	if o.Apply && o.Output == outputJSONL {
+		return fmt.Errorf("apply can not be used together with --output %s, the recommendations are not kept", outputJSONL)
+	}
+	if o.Apply && len(o.envProfiles) > 0 {
+		return fmt.Errorf("apply can not be used together with environment profiles")
+	}
+	if o.Apply && o.FromFile != "" {
+		return fmt.Errorf("apply can not be used together with --from-file")
+	}
+	if o.IgnoreCPUBelow != "" {
+		floor, err := apresource.ParseQuantity(o.IgnoreCPUBelow)
+		if err != nil {
+			return fmt.Errorf("could not parse ignore-cpu-below '%s': %v", o.IgnoreCPUBelow, err)
+		}
+		o.ignoreCPUBelow = floor.MilliValue()
+	}
+	if o.FailOverCPU != "" {
+		value, err := apresource.ParseQuantity(o.FailOverCPU)
+		if err != nil {
+			return fmt.Errorf("could not parse fail-over-cpu '%s': %v", o.FailOverCPU, err)
+		}
+		o.failOverCPU = value.AsApproximateFloat64()
+	}
+	if o.FailOverMem != "" {
+		value, err := apresource.ParseQuantity(o.FailOverMem)
+		if err != nil {
+			return fmt.Errorf("could not parse fail-over-mem '%s': %v", o.FailOverMem, err)
+		}
+		o.failOverMem = value.AsApproximateFloat64()
+	}
+	if o.MinCPUSavings != "" {
+		value, err := apresource.ParseQuantity(o.MinCPUSavings)
+		if err != nil {
+			return fmt.Errorf("could not parse min-cpu-savings '%s': %v", o.MinCPUSavings, err)
+		}
+		o.minCPUSavings = value.AsApproximateFloat64()
+	}
+	if o.MinMemSavings != "" {
+		value, err := apresource.ParseQuantity(o.MinMemSavings)
+		if err != nil {
+			return fmt.Errorf("could not parse min-mem-savings '%s': %v", o.MinMemSavings, err)
+		}
+		o.minMemSavings = value.AsApproximateFloat64()
+	}
+	o.cpuFloor, o.memFloor = 0, 0
+	if o.CPUFloor != "" {
+		value, err := apresource.ParseQuantity(o.CPUFloor)
+		if err != nil || value.Sign() < 0 {
+			return fmt.Errorf("cpu-floor '%s' must be a non-negative quantity, e.g. 50m", o.CPUFloor)
+		}
+		o.cpuFloor = float64(value.MilliValue()) / 1000
+	}
+	if o.MemFloor != "" {
+		value, err := apresource.ParseQuantity(o.MemFloor)
+		if err != nil || value.Sign() < 0 {
+			return fmt.Errorf("mem-floor '%s' must be a non-negative quantity, e.g. 64Mi", o.MemFloor)
+		}
+		o.memFloor = value.AsApproximateFloat64() / 1024 / 1024
+	}
+	o.cpuRound, o.memRound = 100, 100
+	if o.CPURound != "" {
+		value, err := apresource.ParseQuantity(o.CPURound)
+		if err != nil || value.Sign() <= 0 {
+			return fmt.Errorf("cpu-round '%s' must be a positive quantity, e.g. 50m", o.CPURound)
+		}
+		o.cpuRound = float64(value.MilliValue())
+	}
+	if o.MemRound != "" {
+		value, err := apresource.ParseQuantity(o.MemRound)
+		if err != nil || value.Sign() <= 0 {
+			return fmt.Errorf("mem-round '%s' must be a positive quantity, e.g. 128Mi", o.MemRound)
+		}
+		o.memRound = value.AsApproximateFloat64() / 1024 / 1024
+	}
+	return nil
+}
+
+func (o *Options) deploymentMetrics(ctx context.Context, deployment appsv1.Deployment) (prometheusMetrics, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+
+	replicasets, err := o.client.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+
+	replicaset, err := findReplicaset(replicasets, deployment)
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+	glog.V(2).Infof("deployment %s/%s uses replicaset %s", deployment.Namespace, deployment.Name, replicaset.Name)
+
+	// query all pods of the replicaset at once instead of doing the queries pod by pod
+	output, err := o.podUsage(ctx, replicaset.Namespace, replicasetPodRegex(*replicaset))
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+	return o.aggregateMetrics([]prometheusMetrics{output}), nil
+}
+
+// referenceMetrics returns the usage profile of the deployment given in --reference-deployment
+func (o *Options) referenceMetrics(ctx context.Context) (*prometheusMetrics, error) {
+	parts := strings.Split(o.ReferenceDeployment, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("reference deployment '%s' must be in format namespace/name", o.ReferenceDeployment)
+	}
+
+	deployment, err := o.client.AppsV1().Deployments(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	final, err := o.deploymentMetrics(ctx, *deployment)
+	if err != nil {
+		return nil, err
+	}
+	return &final, nil
+}
+
+// suggestedValue converts the suggestion to the unit of the quantities, millicores to cores and MiB to bytes
+func suggestedValue(current int, format apresource.Format) float64 {
+	if format == apresource.DecimalSI {
+		return float64(float64(current) / 1000)
+	}
+	return float64(float64(current) * 1024 * 1024)
+}
+
+func currentValue(resources v1.ResourceRequirements, method string, resource v1.ResourceName, current int, format apresource.Format) (float64, string) {
+	curSaving := suggestedValue(current, format)
+
+	// explicit zero values are handled like undefined ones
+	if method == "limit" {
+		val, ok := resources.Limits[resource]
+		if ok && !val.IsZero() {
+			return val.AsApproximateFloat64() - curSaving, val.String()
+		}
+	} else {
+		val, ok := resources.Requests[resource]
+		if ok && !val.IsZero() {
+			return val.AsApproximateFloat64() - curSaving, val.String()
+		}
+	}
+	return -1 * curSaving, "<nil>"
+}
+
+func (o *Options) analyzeDaemonSet(data []tableEntry, daemonset appsv1.DaemonSet, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	w := Workload{Namespace: daemonset.Namespace, Kind: "daemonset", Name: daemonset.Name}
+	return o.analyzeContainers(data, w, daemonset.Spec.Template.Spec, float64(daemonset.Status.CurrentNumberScheduled), finalMetrics)
+}
+
+func (o *Options) analyzeStatefulset(data []tableEntry, statefulset appsv1.StatefulSet, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	w := Workload{Namespace: statefulset.Namespace, Kind: "statefulset", Name: statefulset.Name}
+	return o.analyzeContainers(data, w, statefulset.Spec.Template.Spec, float64(*statefulset.Spec.Replicas), finalMetrics)
+}
+
+func (o *Options) analyzeDeployment(data []tableEntry, deployment appsv1.Deployment, hpas []autoscalingv2beta2.HorizontalPodAutoscaler, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	w := Workload{Namespace: deployment.Namespace, Kind: "deployment", Name: deployment.Name}
+	if o.IncludeScaledDown && *deployment.Spec.Replicas == 0 {
+		w.Note = "currently scaled to zero"
+	}
+	if target := hpaCPUTarget(hpas, "Deployment", deployment.Name); target > 0 {
+		finalMetrics = o.hpaAdjusted(finalMetrics, target)
+		if w.Note != "" {
+			w.Note += ", "
+		}
+		w.Note += hpaNote(target)
+	}
+	replicas := *deployment.Spec.Replicas
+	if o.Replicas > 0 {
+		// what-if sizing, the savings and the footprint are computed for the given replicas
+		replicas = o.Replicas
+		if w.Note != "" {
+			w.Note += ", "
+		}
+		w.Note += fmt.Sprintf("sized for %d replicas", replicas)
+	}
+	return o.analyzeContainers(data, w, deployment.Spec.Template.Spec, float64(replicas), finalMetrics)
+}
+
+func (o *Options) analyzePod(data []tableEntry, pod v1.Pod, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	w := Workload{Namespace: pod.Namespace, Kind: "pod", Name: pod.Name}
+	return o.analyzeContainers(data, w, pod.Spec, 1, finalMetrics)
+}
+
+func (o *Options) analyzeContainers(data []tableEntry, w Workload, spec v1.PodSpec, replicas float64, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	o.analyzed[w.Kind]++
+	o.namespaceWorkloads[w.Namespace]++
+	start := len(data)
+	finalMetrics = o.attributePodUsage(w, spec, finalMetrics)
+	for _, container := range spec.Containers {
+		if !o.containerSelected(w, container.Name) {
+			continue
+		}
+		o.diagnoseContainer(w.Namespace, w.String(), container, finalMetrics)
+		if crashLooping(finalMetrics, container.Name) {
+			o.addDiagnostic(severityWarning, categoryCrashLoop, w.Namespace, w.String(), container.Name, "Container is in CrashLoopBackOff, its usage does not show what it needs when running, no suggestion is made")
+		}
+	}
+	if len(o.envProfiles) == 0 {
+		data, cpuSave, memSave := o.analyzePodSpec(data, w, spec, replicas, finalMetrics)
+		return o.streamRows(setQOS(data, start, spec), start), cpuSave, memSave
+	}
+
+	// every profile gets its own rows, savings are tracked per profile
+	for _, profile := range o.envProfiles {
+		cpuSave := float64(0.00)
+		memSave := float64(0.00)
+		w.Profile = profile
+		data, cpuSave, memSave = o.analyzePodSpec(data, w, spec, replicas, o.scale(finalMetrics, o.envMultipliers[profile]))
+		o.profileCPUSave[profile] += cpuSave
+		o.profileMemSave[profile] += memSave
+		o.profileSavings[profile] = o.profileSavings[profile].add(cpuSave, memSave)
+	}
+	return o.streamRows(setQOS(data, start, spec), start), 0, 0
+}
+
+func (o *Options) analyzePodSpec(data []tableEntry, w Workload, spec v1.PodSpec, replicas float64, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	finalMetrics = o.applyFloors(finalMetrics)
+	qos := podQOSClass(spec)
+	suggestedCPU := float64(0.00)
+	suggestedMem := float64(0.00)
+	currentCPU := float64(0.00)
+	currentMem := float64(0.00)
+	for _, container := range spec.Containers {
+		// unchanged containers still count in the pod requests
+		if !o.containerSelected(w, container.Name) || !o.hasEnoughData(finalMetrics, container.Name) || crashLooping(finalMetrics, container.Name) {
+			if o.containerSelected(w, container.Name) {
+				glog.V(1).Infof("%s %s %s: no suggestion, not enough usage data or crash looping", w.Namespace, w.String(), container.Name)
+				if !o.hasEnoughData(finalMetrics, container.Name) {
+					o.noMetrics[fmt.Sprintf("%s/%s/%s/%s", w.Namespace, w.Kind, w.Name, container.Name)] = true
+				}
+				data = append(data, o.noSuggestionEntry(w, container.Name, container.Name, finalMetrics))
+			}
+			currentCPU += quantityValue(container.Resources.Requests, v1.ResourceCPU)
+			suggestedCPU += quantityValue(container.Resources.Requests, v1.ResourceCPU)
+			currentMem += quantityValue(container.Resources.Requests, v1.ResourceMemory)
+			suggestedMem += quantityValue(container.Resources.Requests, v1.ResourceMemory)
+			continue
+		}
+
+		reqCpu := int(math.Round(finalMetrics.RequestCPU[container.Name] * 1000))
+		reqMem := int(finalMetrics.RequestMem[container.Name])
+		limCpu := int(math.Round(finalMetrics.LimitCPU[container.Name] * 1000))
+		limMem := int(finalMetrics.LimitMem[container.Name])
+		oomKilled := finalMetrics.OOMKills[container.Name] > 0
+		if oomKilled {
+			limMem = o.oomMemoryLimit(container.Resources, limMem)
+		}
+		throttled := o.ThrottleThreshold > 0 && finalMetrics.Throttled[container.Name] > o.ThrottleThreshold
+		if throttled {
+			limCpu = o.throttledCPULimit(container.Resources, limCpu)
+		}
+
+		if o.ignoreCPUBelow > 0 && int64(reqCpu) < o.ignoreCPUBelow {
+			reqCpu = negligibleCPU(container.Resources, o.ignoreCPUBelow)
+		}
+
+		if o.OverUtilizedAbove > 0 &&
+			!overUtilized(container.Resources, v1.ResourceCPU, float64(reqCpu)/1000, o.OverUtilizedAbove) &&
+			!overUtilized(container.Resources, v1.ResourceMemory, float64(reqMem)*1024*1024, o.OverUtilizedAbove) {
+			glog.V(1).Infof("%s %s %s: no suggestion, not over utilized", w.Namespace, w.String(), container.Name)
+			continue
+		}
+
+		// guaranteed pods need the requests equal to the limits, the limits keep the headroom
+		if o.PreserveQOS && qos == v1.PodQOSGuaranteed {
+			reqCpu, reqMem = limCpu, limMem
+		}
+
+		reqCpuSave, _ := currentValue(container.Resources, "request", v1.ResourceCPU, reqCpu, apresource.DecimalSI)
+		reqMemSave, _ := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
+
+		if o.FailOnDrift {
+			o.checkDrift(w.Namespace, w.String(), container, reqCpu, reqMem)
+		}
+
+		rec := Recommendation{
+			Workload:          w,
+			Container:         container.Name,
+			Replicas:          replicas,
+			CurrentRequestCPU: quantityValue(container.Resources.Requests, v1.ResourceCPU),
+			CurrentRequestMem: quantityValue(container.Resources.Requests, v1.ResourceMemory),
+			CurrentLimitCPU:   quantityValue(container.Resources.Limits, v1.ResourceCPU),
+			CurrentLimitMem:   quantityValue(container.Resources.Limits, v1.ResourceMemory),
+			RequestCPU:        float64(reqCpu) / 1000,
+			RequestMem:        float64(reqMem) * 1024 * 1024,
+			LimitCPU:          float64(limCpu) / 1000,
+			LimitMem:          float64(limMem) * 1024 * 1024,
+			OOMKilled:         oomKilled,
+			Throttled:         throttled,
+			QOSClass:          qos,
+			DropCPULimit:      o.dropCPULimit(qos),
+			MinUsageCPU:       finalMetrics.MinCPU[container.Name],
+			MinUsageMem:       finalMetrics.MinMem[container.Name] * 1024 * 1024,
+		}
+		if rec.DropCPULimit {
+			rec.LimitCPU = 0
+		}
+		rec.CPUSavings = (rec.CurrentRequestCPU - rec.RequestCPU) * replicas
+		rec.MemSavings = (rec.CurrentRequestMem - rec.RequestMem) * replicas
+		if o.belowMinSavings(rec) && !oomKilled && !throttled {
+			glog.V(1).Infof("%s %s %s: no suggestion, savings below the threshold", w.Namespace, w.String(), container.Name)
+			o.hiddenContainers++
+			currentCPU += rec.CurrentRequestCPU
+			suggestedCPU += rec.CurrentRequestCPU
+			currentMem += rec.CurrentRequestMem
+			suggestedMem += rec.CurrentRequestMem
+			continue
+		}
+		if o.wellSized(rec) && !oomKilled && !throttled {
+			glog.V(1).Infof("%s %s %s: no suggestion, well-sized", w.Namespace, w.String(), container.Name)
+			o.wellSizedContainers++
+			currentCPU += rec.CurrentRequestCPU
+			suggestedCPU += rec.CurrentRequestCPU
+			currentMem += rec.CurrentRequestMem
+			suggestedMem += rec.CurrentRequestMem
+			continue
+		}
+		o.addRecommendation(rec)
+
+		suggestedCPU += suggestedValue(reqCpu, apresource.DecimalSI)
+		suggestedMem += suggestedValue(reqMem, apresource.BinarySI)
+		currentCPU += reqCpuSave + suggestedValue(reqCpu, apresource.DecimalSI)
+		currentMem += reqMemSave + suggestedValue(reqMem, apresource.BinarySI)
+		data = append(data, recommendationEntry(rec, container.Resources))
+	}
+
+	currentInitCPU := float64(0.00)
+	currentInitMem := float64(0.00)
+	suggestedInitCPU := float64(0.00)
+	suggestedInitMem := float64(0.00)
+	for _, container := range spec.InitContainers {
+		initCPU := float64(0.00)
+		initMem := float64(0.00)
+		data, initCPU, initMem = o.analyzeInitContainer(data, w, container, replicas, qos, finalMetrics)
+		currentInitCPU = math.Max(currentInitCPU, quantityValue(container.Resources.Requests, v1.ResourceCPU))
+		currentInitMem = math.Max(currentInitMem, quantityValue(container.Resources.Requests, v1.ResourceMemory))
+		suggestedInitCPU = math.Max(suggestedInitCPU, initCPU)
+		suggestedInitMem = math.Max(suggestedInitMem, initMem)
+	}
+
+	podCurrentCPU := effectiveRequest(spec, v1.ResourceCPU, currentCPU, currentInitCPU) * replicas
+	podSuggestedCPU := effectiveRequest(spec, v1.ResourceCPU, suggestedCPU, suggestedInitCPU) * replicas
+	podCurrentMem := effectiveRequest(spec, v1.ResourceMemory, currentMem, currentInitMem) * replicas
+	podSuggestedMem := effectiveRequest(spec, v1.ResourceMemory, suggestedMem, suggestedInitMem) * replicas
+	if w.Profile == "" {
+		o.addNamespaceTotal(w.Namespace, podCurrentCPU, podSuggestedCPU, podCurrentMem, podSuggestedMem)
+	}
+	return data, podCurrentCPU - podSuggestedCPU, podCurrentMem - podSuggestedMem
+}
+
+// oomMemoryLimit never lets the memory limit (MiB) of an OOM killed container decrease,
+// the current limit is raised with the limit margin instead
+func (o *Options) oomMemoryLimit(resources v1.ResourceRequirements, suggested int) int {
+	current := quantityValue(resources.Limits, v1.ResourceMemory) / 1024 / 1024
+	if current <= 0 {
+		return suggested
+	}
+	bumped := int(o.roundMem(current * (1 + o.LimitMargin)))
+	if bumped > suggested {
+		return bumped
+	}
+	return suggested
+}
+
+// throttledCPULimit never lets the cpu limit (millicores) of a throttled container decrease,
+// the current limit is raised with the limit margin instead
+func (o *Options) throttledCPULimit(resources v1.ResourceRequirements, suggested int) int {
+	current := quantityValue(resources.Limits, v1.ResourceCPU)
+	if current <= 0 {
+		return suggested
+	}
+	bumped := int(math.Round(o.roundCPU(current*(1+o.LimitMargin)) * 1000))
+	if bumped > suggested {
+		return bumped
+	}
+	return suggested
+}
+
+// hasEnoughData tells if there is usage data of the container, suggesting zero for containers without data would be reckless
+func (o *Options) hasEnoughData(finalMetrics prometheusMetrics, container string) bool {
+	_, cpu := finalMetrics.RequestCPU[container]
+	_, mem := finalMetrics.RequestMem[container]
+	if !cpu || !mem {
+		return false
+	}
+	return o.MinSamples <= 0 || finalMetrics.Samples[container] >= float64(o.MinSamples)
+}
+
+// belowMinSavings tells if the savings of the container are too small to be shown with --min-cpu-savings and --min-mem-savings
+func (o *Options) belowMinSavings(rec Recommendation) bool {
+	if o.minCPUSavings <= 0 && o.minMemSavings <= 0 {
+		return false
+	}
+	cpuBelow := o.minCPUSavings <= 0 || math.Abs(rec.CPUSavings) < o.minCPUSavings
+	memBelow := o.minMemSavings <= 0 || math.Abs(rec.MemSavings) < o.minMemSavings
+	return cpuBelow && memBelow
+}
+
+// dropCPULimit tells if the cpu limit is suggested to be removed, guaranteed pods keep theirs with --preserve-qos
+func (o *Options) dropCPULimit(qos v1.PodQOSClass) bool {
+	return o.DropCPULimits && !(o.PreserveQOS && qos == v1.PodQOSGuaranteed)
+}
+
+// cpuLimitCell formats the suggested cpu limit (millicores) and the current one for the table
+func cpuLimitCell(limCpu int, current string, drop bool) string {
+	if drop {
+		return fmt.Sprintf("remove (%s)", current)
+	}
+	return fmt.Sprintf("%dm (%s)", limCpu, current)
+}
+
+// wellSized tells if the container is hidden with --changes-only, none of its values would change beyond the thresholds
+func (o *Options) wellSized(rec Recommendation) bool {
+	return o.ChangesOnly && containerPatch(rec, o.exceedsThresholds) == nil
+}
+
+// formatSavings shows increases with a plus sign so they stand out from the savings
+func formatSavings(value float64, unit string) string {
+	if value < 0 {
+		return fmt.Sprintf("+%.0f%s", -value, unit)
+	}
+	return fmt.Sprintf("%.0f%s", value, unit)
+}
+
+// analyzeInitContainer suggests the peak usage with the limit margin as request and limit of the init container.
+// Init containers run alone, so a quantile of their short lived usage would be too small.
+// Returns the suggested requests as cores and bytes, the current ones if there is no usage data.
+func (o *Options) analyzeInitContainer(data []tableEntry, w Workload, container v1.Container, replicas float64, qos v1.PodQOSClass, finalMetrics prometheusMetrics) ([]tableEntry, float64, float64) {
+	name := fmt.Sprintf("%s (init)", container.Name)
+	if !o.containerSelected(w, container.Name) || !o.hasEnoughData(finalMetrics, container.Name) || crashLooping(finalMetrics, container.Name) {
+		if o.containerSelected(w, container.Name) {
+			if !o.hasEnoughData(finalMetrics, container.Name) {
+				o.noMetrics[fmt.Sprintf("%s/%s/%s/%s", w.Namespace, w.Kind, w.Name, name)] = true
+			}
+			data = append(data, o.noSuggestionEntry(w, name, container.Name, finalMetrics))
+		}
+		return data, quantityValue(container.Resources.Requests, v1.ResourceCPU), quantityValue(container.Resources.Requests, v1.ResourceMemory)
+	}
+
+	reqCpu := int(math.Round(finalMetrics.LimitCPU[container.Name] * 1000))
+	reqMem := int(finalMetrics.LimitMem[container.Name])
+	suggestedCPU := suggestedValue(reqCpu, apresource.DecimalSI)
+	suggestedMem := suggestedValue(reqMem, apresource.BinarySI)
+
+	if o.OverUtilizedAbove > 0 &&
+		!overUtilized(container.Resources, v1.ResourceCPU, suggestedCPU, o.OverUtilizedAbove) &&
+		!overUtilized(container.Resources, v1.ResourceMemory, suggestedMem, o.OverUtilizedAbove) {
+		return data, suggestedCPU, suggestedMem
+	}
+
+	rec := Recommendation{
+		Workload:          w,
+		Container:         container.Name,
+		Init:              true,
+		Replicas:          replicas,
+		CurrentRequestCPU: quantityValue(container.Resources.Requests, v1.ResourceCPU),
+		CurrentRequestMem: quantityValue(container.Resources.Requests, v1.ResourceMemory),
+		CurrentLimitCPU:   quantityValue(container.Resources.Limits, v1.ResourceCPU),
+		CurrentLimitMem:   quantityValue(container.Resources.Limits, v1.ResourceMemory),
+		RequestCPU:        suggestedCPU,
+		RequestMem:        suggestedMem,
+		LimitCPU:          suggestedCPU,
+		LimitMem:          suggestedMem,
+		QOSClass:          qos,
+		DropCPULimit:      o.dropCPULimit(qos),
+	}
+	if rec.DropCPULimit {
+		rec.LimitCPU = 0
+	}
+	rec.CPUSavings = (rec.CurrentRequestCPU - rec.RequestCPU) * replicas
+	rec.MemSavings = (rec.CurrentRequestMem - rec.RequestMem) * replicas
+	if o.belowMinSavings(rec) {
+		o.hiddenContainers++
+		return data, rec.CurrentRequestCPU, rec.CurrentRequestMem
+	}
+	if o.wellSized(rec) {
+		o.wellSizedContainers++
+		return data, rec.CurrentRequestCPU, rec.CurrentRequestMem
+	}
+	o.addRecommendation(rec)
+
+	data = append(data, recommendationEntry(rec, container.Resources))
+	return data, suggestedCPU, suggestedMem
+}
+
+// quantityValue returns the resource as cores or bytes, zero if it is not defined
+func quantityValue(resources v1.ResourceList, resource v1.ResourceName) float64 {
+	val, ok := resources[resource]
+	if !ok {
+		return 0
+	}
+	return val.AsApproximateFloat64()
+}
+
+// effectiveRequest returns the request the scheduler uses for the pod when its containers request the given sum.
+// Init containers run one at a time so only the biggest one counts, and the pod overhead is added on top.
+func effectiveRequest(spec v1.PodSpec, resource v1.ResourceName, containers float64, initContainers float64) float64 {
+	effective := math.Max(containers, initContainers)
+	if val, ok := spec.Overhead[resource]; ok {
+		effective += val.AsApproximateFloat64()
+	}
+	return effective
+}
+
+// checkBudget records the workload if its savings exceed --fail-over-cpu or --fail-over-mem
+func (o *Options) checkBudget(namespace string, resource string, cpuSave float64, memSave float64) {
+	if o.failOverCPU > 0 && cpuSave > o.failOverCPU {
+		o.overBudget = append(o.overBudget, fmt.Sprintf("%s %s: could save %.2f vCPUs", namespace, resource, cpuSave))
+	}
+	if o.failOverMem > 0 && memSave > o.failOverMem {
+		o.overBudget = append(o.overBudget, fmt.Sprintf("%s %s: could save %s memory", namespace, resource, o.byteCount(int64(memSave))))
+	}
+}
+
+// checkDrift records the container if its current requests differ too much from the suggested ones
+func (o *Options) checkDrift(namespace string, resource string, container v1.Container, reqCpu int, reqMem int) {
+	cpu, ok := container.Resources.Requests[v1.ResourceCPU]
+	if ok {
+		ratio := driftRatio(cpu.AsApproximateFloat64(), float64(reqCpu)/1000)
+		if ratio > o.DriftThreshold {
+			o.drifts = append(o.drifts, fmt.Sprintf("%s %s %s: cpu request %s vs suggested %dm (%.2fx)", namespace, resource, container.Name, cpu.String(), reqCpu, ratio))
+		}
+	}
+	mem, ok := container.Resources.Requests[v1.ResourceMemory]
+	if ok {
+		ratio := driftRatio(mem.AsApproximateFloat64(), float64(reqMem)*1024*1024)
+		if ratio > o.DriftThreshold {
+			o.drifts = append(o.drifts, fmt.Sprintf("%s %s %s: memory request %s vs suggested %dMi (%.2fx)", namespace, resource, container.Name, mem.String(), reqMem, ratio))
+		}
+	}
+}
+
+// driftRatio returns how many times bigger or smaller the current value is compared to the suggested one
+func driftRatio(current float64, suggested float64) float64 {
+	if current <= 0 || suggested <= 0 {
+		return 0
+	}
+	if current > suggested {
+		return current / suggested
+	}
+	return suggested / current
+}
+
+// overUtilized returns true if the usage is above the ratio of the current request, or the limit if there is no request
+func overUtilized(resources v1.ResourceRequirements, resource v1.ResourceName, usage float64, ratio float64) bool {
+	current := quantityValue(resources.Requests, resource)
+	if current == 0 {
+		current = quantityValue(resources.Limits, resource)
+	}
+	if current == 0 {
+		return false
+	}
+	return usage/current > ratio
+}
+
+// negligibleCPU returns the cpu request in millicores for containers which usage is below the floor.
+// Existing requests are left alone, undefined ones get the floor.
+func negligibleCPU(resources v1.ResourceRequirements, floor int64) int {
+	val, ok := resources.Requests[v1.ResourceCPU]
+	if ok && val.MilliValue() > 0 {
+		return int(val.MilliValue())
 	}
-	return data, totalCPUSavings, totalMemSavings
+	return int(floor)
 }
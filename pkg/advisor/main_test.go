@@ -0,0 +1,201 @@
+package advisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const gib = 1024 * 1024 * 1024
+
+func TestAddSavings(t *testing.T) {
+	o := &Options{namespaceCPUSave: map[string]float64{}, namespaceMemSave: map[string]float64{}}
+	o.addSavings("shop", 2, 4*gib)
+	o.addSavings("shop", -0.5, -1*gib)
+	o.addSavings("batch", 1.5, -2*gib)
+	o.addSavings("batch", 0, 0)
+
+	want := savings{ReclaimCPU: 3.5, AddCPU: 0.5, ReclaimMem: 4 * gib, AddMem: 3 * gib}
+	if o.totals != want {
+		t.Errorf("totals = %+v, want %+v", o.totals, want)
+	}
+	if o.totalCPUSave != 3 || o.totalMemSave != 1*gib {
+		t.Errorf("net savings = %g cores %g bytes, want 3 cores and 1 GiB", o.totalCPUSave, o.totalMemSave)
+	}
+	if o.namespaceCPUSave["shop"] != 1.5 || o.namespaceMemSave["shop"] != 3*gib {
+		t.Errorf("shop savings = %g cores %g bytes, want 1.5 cores and 3 GiB", o.namespaceCPUSave["shop"], o.namespaceMemSave["shop"])
+	}
+	if o.namespaceCPUSave["batch"] != 1.5 || o.namespaceMemSave["batch"] != -2*gib {
+		t.Errorf("batch savings = %g cores %g bytes, want 1.5 cores and -2 GiB", o.namespaceCPUSave["batch"], o.namespaceMemSave["batch"])
+	}
+}
+
+func TestPrintSavings(t *testing.T) {
+	tests := []struct {
+		name    string
+		savings savings
+		want    string
+	}{
+		{
+			name:    "only reductions",
+			savings: savings{ReclaimCPU: 1.25, ReclaimMem: 12 * gib},
+			want:    "You could reclaim 1.25 vCPUs and 12.0 GiB Memory by changing the settings\n",
+		},
+		{
+			name:    "reductions and increases",
+			savings: savings{ReclaimCPU: 2, AddCPU: 0.5, ReclaimMem: 12 * gib, AddMem: 3 * gib},
+			want: "You could reclaim 2.00 vCPUs and 12.0 GiB Memory by changing the settings\n" +
+				"Workloads needing more would add 0.50 vCPUs and 3.0 GiB Memory\n" +
+				"Net change: 1.50 vCPUs and 9.0 GiB Memory\n",
+		},
+		{
+			name:    "net increase",
+			savings: savings{ReclaimCPU: 0.5, AddCPU: 2, ReclaimMem: 1 * gib, AddMem: 3 * gib},
+			want: "You could reclaim 0.50 vCPUs and 1.0 GiB Memory by changing the settings\n" +
+				"Workloads needing more would add 2.00 vCPUs and 3.0 GiB Memory\n" +
+				"Net change: -1.50 vCPUs and -2.0 GiB Memory\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{}
+			var out bytes.Buffer
+			o.printSavings(&out, tt.savings)
+			if out.String() != tt.want {
+				t.Errorf("printSavings() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedBytes(t *testing.T) {
+	o := &Options{}
+	for value, want := range map[float64]string{0: "0 B", 512 * 1024 * 1024: "512.0 MiB", -1.5 * gib: "-1.5 GiB"} {
+		if got := o.signedBytes(value); got != want {
+			t.Errorf("signedBytes(%g) = %s, want %s", value, got, want)
+		}
+	}
+	for value, want := range map[float64]string{0: "0.00", 0.125: "0.12", -2: "-2.00"} {
+		if got := signedCores(value); got != want {
+			t.Errorf("signedCores(%g) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestCurrentValueUndefined(t *testing.T) {
+	zero := v1.ResourceList{v1.ResourceCPU: apresource.MustParse("0"), v1.ResourceMemory: apresource.MustParse("0")}
+	tests := []struct {
+		name      string
+		resources v1.ResourceRequirements
+		method    string
+	}{
+		{name: "zero request", resources: v1.ResourceRequirements{Requests: zero}, method: "request"},
+		{name: "missing request", resources: v1.ResourceRequirements{}, method: "request"},
+		{name: "zero limit", resources: v1.ResourceRequirements{Limits: zero}, method: "limit"},
+		{name: "missing limit", resources: v1.ResourceRequirements{}, method: "limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// an undefined value saves nothing, defining it costs the suggestion
+			save, current := currentValue(tt.resources, tt.method, v1.ResourceCPU, 200, apresource.DecimalSI)
+			if current != "<nil>" || save != -0.2 {
+				t.Errorf("cpu currentValue() = %g, %s, want -0.2, <nil>", save, current)
+			}
+			save, current = currentValue(tt.resources, tt.method, v1.ResourceMemory, 256, apresource.BinarySI)
+			if current != "<nil>" || save != -256*1024*1024 {
+				t.Errorf("memory currentValue() = %g, %s, want -256Mi, <nil>", save, current)
+			}
+		})
+	}
+}
+
+func TestCurrentValueSavings(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		resource  v1.ResourceName
+		suggested int
+		format    apresource.Format
+		want      float64
+		wantSpec  string
+	}{
+		{name: "500m cpu using 200m", requested: "500m", resource: v1.ResourceCPU, suggested: 200, format: apresource.DecimalSI, want: 0.3, wantSpec: "500m"},
+		{name: "2 cores using 2500m", requested: "2", resource: v1.ResourceCPU, suggested: 2500, format: apresource.DecimalSI, want: -0.5, wantSpec: "2"},
+		{name: "1Gi memory using 256Mi", requested: "1Gi", resource: v1.ResourceMemory, suggested: 256, format: apresource.BinarySI, want: 768 * 1024 * 1024, wantSpec: "1Gi"},
+		{name: "512Mi memory using 1Gi", requested: "512Mi", resource: v1.ResourceMemory, suggested: 1024, format: apresource.BinarySI, want: -512 * 1024 * 1024, wantSpec: "512Mi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := v1.ResourceRequirements{Requests: v1.ResourceList{tt.resource: apresource.MustParse(tt.requested)}}
+			save, spec := currentValue(resources, "request", tt.resource, tt.suggested, tt.format)
+			// cpu savings are in cores and memory savings in bytes
+			if math.Abs(save-tt.want) > 1e-9 || spec != tt.wantSpec {
+				t.Errorf("currentValue() = %g, %s, want %g, %s", save, spec, tt.want, tt.wantSpec)
+			}
+		})
+	}
+}
+
+func TestRunKeepsOutputFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	err := ioutil.WriteFile(report, []byte("previous report"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Run(&Options{Output: "xml", OutputFile: report})
+	if err == nil {
+		t.Fatal("Run() with an unknown output succeeded")
+	}
+	content, err := ioutil.ReadFile(report)
+	if err != nil || string(content) != "previous report" {
+		t.Errorf("output file = %q, %v, want the previous report", content, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Errorf("output directory has %d files, want only the report", len(files))
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		failFast bool
+		wantErr  bool
+		partial  bool
+		recorded int
+	}{
+		{name: "tolerated", ctx: context.Background(), recorded: 1},
+		{name: "fail fast", ctx: context.Background(), failFast: true, wantErr: true},
+		{name: "deadline exceeded", ctx: expired, failFast: true, wantErr: true, partial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{FailFast: tt.failFast}
+			if err := o.handleError(tt.ctx, "namespace shop", errors.New("forbidden")); (err != nil) != tt.wantErr {
+				t.Errorf("handleError() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if len(o.workloadErrors) != tt.recorded {
+				t.Errorf("recorded %d errors, want %d", len(o.workloadErrors), tt.recorded)
+			}
+			if o.partial != tt.partial {
+				t.Errorf("partial = %t, want %t", o.partial, tt.partial)
+			}
+		})
+	}
+	if err := (&Options{}).handleError(context.Background(), "namespace shop", nil); err != nil {
+		t.Errorf("handleError() of no error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,109 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const podMetricsPath = "/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods"
+
+// podMetricsList is the part of the metrics.k8s.io PodMetricsList used by the advisor
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Containers        []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string          `json:"name"`
+	Usage v1.ResourceList `json:"usage"`
+}
+
+// podUsage returns the usage of the pods in the namespace whose name matches the regular expression
+func (o *Options) podUsage(ctx context.Context, namespace string, podRegex string) (prometheusMetrics, error) {
+	if o.Backend == backendMetricsServer {
+		return o.metricsServerUsage(ctx, namespace, podRegex)
+	}
+	return o.queryPrometheusForSelector(ctx, o.promClient, fmt.Sprintf(`namespace="%s", pod=~"%s"`, namespace, podRegex))
+}
+
+// metricsServerUsage builds the usage from the current values of metrics-server. There is no history to compute
+// quantiles from, so the current usage of the matching pods is used for both the request and the limit
+func (o *Options) metricsServerUsage(ctx context.Context, namespace string, podRegex string) (prometheusMetrics, error) {
+	output := newPrometheusMetrics()
+	pattern, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", podRegex))
+	if err != nil {
+		return output, err
+	}
+
+	list, err := o.namespacePodMetrics(ctx, namespace)
+	if err != nil {
+		return output, err
+	}
+
+	multiplier := 1 + o.LimitMargin
+	requestCPU := make(map[string][]float64)
+	requestMem := make(map[string][]float64)
+	for _, pod := range list.Items {
+		if !pattern.MatchString(pod.Name) {
+			continue
+		}
+		for _, container := range pod.Containers {
+			cpu := container.Usage.Cpu().AsApproximateFloat64()
+			mem := container.Usage.Memory().AsApproximateFloat64() / 1024 / 1024
+			requestCPU[container.Name] = append(requestCPU[container.Name], cpu)
+			requestMem[container.Name] = append(requestMem[container.Name], mem)
+			output.LimitCPU[container.Name] = math.Max(output.LimitCPU[container.Name], cpu*multiplier)
+			output.LimitMem[container.Name] = math.Max(output.LimitMem[container.Name], mem*multiplier)
+		}
+	}
+	for container, values := range requestCPU {
+		output.RequestCPU[container] = o.aggregatePods(values)
+	}
+	for container, values := range requestMem {
+		output.RequestMem[container] = o.aggregatePods(values)
+	}
+	return output, nil
+}
+
+// namespacePodMetrics lists the pod metrics of the namespace once per run, the workloads share the same list
+func (o *Options) namespacePodMetrics(ctx context.Context, namespace string) (*podMetricsList, error) {
+	o.podMetricsLock.Lock()
+	defer o.podMetricsLock.Unlock()
+
+	if list, ok := o.podMetrics[namespace]; ok {
+		return list, nil
+	}
+
+	body, err := o.client.CoreV1().RESTClient().Get().AbsPath(fmt.Sprintf(podMetricsPath, namespace)).DoRaw(ctx)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("metrics.k8s.io is not served by the cluster, is metrics-server installed? %v", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list pod metrics in namespace %s: %v", namespace, err)
+	}
+
+	list := &podMetricsList{}
+	err = json.Unmarshal(body, list)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse pod metrics in namespace %s: %v", namespace, err)
+	}
+	glog.V(2).Infof("metrics-server returned %d pods in namespace %s", len(list.Items), namespace)
+
+	if o.podMetrics == nil {
+		o.podMetrics = make(map[string]*podMetricsList)
+	}
+	o.podMetrics[namespace] = list
+	return list, nil
+}
@@ -0,0 +1,405 @@
+package advisor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/golang/glog"
+	apresource "k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+func (w Workload) String() string {
+	output := fmt.Sprintf("%s/%s", w.Kind, w.Name)
+	if w.Note != "" {
+		output = fmt.Sprintf("%s (%s)", output, w.Note)
+	}
+	if w.Profile != "" {
+		output = fmt.Sprintf("%s [%s]", output, w.Profile)
+	}
+	return output
+}
+
+func (o *Options) machineOutput() bool {
+	return o.Output != outputTable && o.Output != outputWide
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// renderKubecostCSV writes the recommendations in the rightsizing import schema of kubecost
+func renderKubecostCSV(w io.Writer, cluster string, recommendations []Recommendation) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"cluster", "namespace", "controller", "controllerKind", "container", "cpuRequestCores", "cpuRecommendedCores", "ramRequestBytes", "ramRecommendedBytes"})
+	if err != nil {
+		return err
+	}
+	for _, r := range recommendations {
+		err = writer.Write([]string{
+			cluster,
+			r.Workload.Namespace,
+			r.Workload.Name,
+			r.Workload.Kind,
+			r.Container,
+			formatFloat(r.CurrentRequestCPU),
+			formatFloat(r.RequestCPU),
+			formatFloat(r.CurrentRequestMem),
+			formatFloat(r.RequestMem),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func millicores(cores float64) string {
+	return formatFloat(math.Round(cores * 1000))
+}
+
+func bytesValue(bytes float64) string {
+	return formatFloat(math.Round(bytes))
+}
+
+// renderCSV writes the table columns as plain numbers, cpu in millicores and memory in bytes
+func renderCSV(w io.Writer, recommendations []Recommendation) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"namespace", "kind", "name", "profile", "container", "replicas",
+		"currentRequestCPUMillicores", "requestCPUMillicores", "currentRequestMemoryBytes", "requestMemoryBytes",
+		"currentLimitCPUMillicores", "limitCPUMillicores", "currentLimitMemoryBytes", "limitMemoryBytes",
+		"cpuSavingsMillicores", "memorySavingsBytes",
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range recommendations {
+		err = writer.Write([]string{
+			r.Workload.Namespace,
+			r.Workload.Kind,
+			r.Workload.Name,
+			r.Workload.Profile,
+			r.Container,
+			formatFloat(r.Replicas),
+			millicores(r.CurrentRequestCPU),
+			millicores(r.RequestCPU),
+			bytesValue(r.CurrentRequestMem),
+			bytesValue(r.RequestMem),
+			millicores(r.CurrentLimitCPU),
+			millicores(r.LimitCPU),
+			bytesValue(r.CurrentLimitMem),
+			bytesValue(r.LimitMem),
+			millicores(r.CPUSavings),
+			bytesValue(r.MemSavings),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func renderJSON(w io.Writer, recommendations []Recommendation) error {
+	if recommendations == nil {
+		recommendations = []Recommendation{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report{
+		Version:         Version,
+		Recommendations: recommendations,
+	})
+}
+
+func cpuQuantity(cores float64) string {
+	return apresource.NewMilliQuantity(int64(math.Round(cores*1000)), apresource.DecimalSI).String()
+}
+
+func memoryQuantity(bytes float64) string {
+	return apresource.NewQuantity(int64(math.Round(bytes)), apresource.BinarySI).String()
+}
+
+// differs returns true if the values are not equal when rounded to millicores or millibytes
+func differs(current float64, suggested float64) bool {
+	return math.Round(current*1000) != math.Round(suggested*1000)
+}
+
+// containerPatch returns the changed resources of the container, nil if nothing changes
+func containerPatch(r Recommendation, changed func(current float64, suggested float64) bool) map[string]interface{} {
+	requests := map[string]string{}
+	limits := map[string]interface{}{}
+	if r.RequestCPU > 0 && changed(r.CurrentRequestCPU, r.RequestCPU) {
+		requests["cpu"] = cpuQuantity(r.RequestCPU)
+	}
+	if r.RequestMem > 0 && changed(r.CurrentRequestMem, r.RequestMem) {
+		requests["memory"] = memoryQuantity(r.RequestMem)
+	}
+	if r.LimitCPU > 0 && changed(r.CurrentLimitCPU, r.LimitCPU) {
+		limits["cpu"] = cpuQuantity(r.LimitCPU)
+	}
+	// null removes the limit in a strategic merge patch
+	if r.DropCPULimit && r.CurrentLimitCPU > 0 {
+		limits["cpu"] = nil
+	}
+	if r.LimitMem > 0 && changed(r.CurrentLimitMem, r.LimitMem) {
+		limits["memory"] = memoryQuantity(r.LimitMem)
+	}
+	if len(requests) == 0 && len(limits) == 0 {
+		return nil
+	}
+
+	resources := map[string]interface{}{}
+	if len(requests) > 0 {
+		resources["requests"] = requests
+	}
+	if len(limits) > 0 {
+		resources["limits"] = limits
+	}
+	return map[string]interface{}{
+		"name":      r.Container,
+		"resources": resources,
+	}
+}
+
+// workloadPatches groups the container patches into a strategic merge patch per workload
+func workloadPatches(recommendations []Recommendation, changed func(current float64, suggested float64) bool) ([]Workload, map[Workload]map[string]interface{}) {
+	order := []Workload{}
+	containers := make(map[Workload][]interface{})
+	initContainers := make(map[Workload][]interface{})
+	for _, r := range recommendations {
+		patch := containerPatch(r, changed)
+		if patch == nil {
+			continue
+		}
+		if len(containers[r.Workload]) == 0 && len(initContainers[r.Workload]) == 0 {
+			order = append(order, r.Workload)
+		}
+		if r.Init {
+			initContainers[r.Workload] = append(initContainers[r.Workload], patch)
+		} else {
+			containers[r.Workload] = append(containers[r.Workload], patch)
+		}
+	}
+
+	patches := make(map[Workload]map[string]interface{})
+	for _, w := range order {
+		spec := map[string]interface{}{}
+		if len(containers[w]) > 0 {
+			spec["containers"] = containers[w]
+		}
+		if len(initContainers[w]) > 0 {
+			spec["initContainers"] = initContainers[w]
+		}
+		template := map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": spec,
+			},
+		}
+		// the pod template of a cronjob is inside its job template
+		if w.Kind == "cronjob" {
+			template = map[string]interface{}{
+				"jobTemplate": map[string]interface{}{
+					"spec": template,
+				},
+			}
+		}
+		patches[w] = map[string]interface{}{
+			"spec": template,
+		}
+	}
+	return order, patches
+}
+
+// renderYAML writes a strategic merge patch document per workload
+func renderYAML(w io.Writer, recommendations []Recommendation) error {
+	order, patches := workloadPatches(recommendations, differs)
+	for _, wl := range order {
+		content, err := yaml.Marshal(patches[wl])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n# kubectl -n %s patch %s %s --patch-file <file>\n%s", wl.Namespace, wl.Kind, wl.Name, content)
+	}
+	return nil
+}
+
+var vpaTargetKinds = map[string]string{
+	"deployment":  "Deployment",
+	"statefulset": "StatefulSet",
+	"daemonset":   "DaemonSet",
+}
+
+// containerPolicy bounds the VPA recommendation of the container between the lowest observed usage and the
+// suggested limit, the vpa recommends its own requests within them
+func containerPolicy(r Recommendation) map[string]interface{} {
+	minAllowed := map[string]string{}
+	maxAllowed := map[string]string{}
+	if r.MinUsageCPU > 0 {
+		minAllowed["cpu"] = cpuQuantity(r.MinUsageCPU)
+	}
+	if r.MinUsageMem > 0 {
+		minAllowed["memory"] = memoryQuantity(r.MinUsageMem)
+	}
+	if r.LimitCPU > 0 {
+		maxAllowed["cpu"] = cpuQuantity(r.LimitCPU)
+	}
+	if r.LimitMem > 0 {
+		maxAllowed["memory"] = memoryQuantity(r.LimitMem)
+	}
+	return map[string]interface{}{
+		"containerName": r.Container,
+		"minAllowed":    minAllowed,
+		"maxAllowed":    maxAllowed,
+	}
+}
+
+// renderVPA writes a VerticalPodAutoscaler in recommendation only mode per workload
+func renderVPA(w io.Writer, recommendations []Recommendation) error {
+	order := []Workload{}
+	policies := make(map[Workload][]interface{})
+	for _, r := range recommendations {
+		if _, ok := vpaTargetKinds[r.Workload.Kind]; !ok || r.Init {
+			continue
+		}
+		if _, ok := policies[r.Workload]; !ok {
+			order = append(order, r.Workload)
+		}
+		policies[r.Workload] = append(policies[r.Workload], containerPolicy(r))
+	}
+
+	for _, wl := range order {
+		name := wl.Name
+		if wl.Profile != "" {
+			name = fmt.Sprintf("%s-%s", name, wl.Profile)
+		}
+		vpa := map[string]interface{}{
+			"apiVersion": "autoscaling.k8s.io/v1",
+			"kind":       "VerticalPodAutoscaler",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": wl.Namespace,
+			},
+			"spec": map[string]interface{}{
+				"targetRef": map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       vpaTargetKinds[wl.Kind],
+					"name":       wl.Name,
+				},
+				"updatePolicy": map[string]interface{}{
+					"updateMode": "Off",
+				},
+				"resourcePolicy": map[string]interface{}{
+					"containerPolicies": policies[wl],
+				},
+			},
+		}
+		content, err := yaml.Marshal(vpa)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n%s", content)
+	}
+	return nil
+}
+
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// renderDiff writes a unified diff like view of the current and the suggested resources of every container
+func renderDiff(w io.Writer, recommendations []Recommendation, color bool) error {
+	line := func(prefix string, text string) {
+		switch {
+		case color && prefix == "-":
+			fmt.Fprintf(w, "%s%s%s%s\n", colorRed, prefix, text, colorReset)
+		case color && prefix == "+":
+			fmt.Fprintf(w, "%s%s%s%s\n", colorGreen, prefix, text, colorReset)
+		default:
+			fmt.Fprintf(w, "%s%s\n", prefix, text)
+		}
+	}
+	value := func(name string, current string, suggested string) {
+		if current == suggested {
+			if current != "" {
+				line(" ", fmt.Sprintf("    %s: %s", name, current))
+			}
+			return
+		}
+		if current != "" {
+			line("-", fmt.Sprintf("    %s: %s", name, current))
+		}
+		if suggested != "" {
+			line("+", fmt.Sprintf("    %s: %s", name, suggested))
+		}
+	}
+	quantity := func(value float64, format func(float64) string) string {
+		if value <= 0 {
+			return ""
+		}
+		return format(value)
+	}
+
+	for _, r := range recommendations {
+		target := fmt.Sprintf("%s/%s/%s", r.Workload.Namespace, r.Workload.Kind, r.Workload.Name)
+		line("---", fmt.Sprintf(" %s %s (current)", target, r.Container))
+		line("+++", fmt.Sprintf(" %s %s (suggested)", target, r.Container))
+		line(" ", "resources:")
+		line(" ", "  requests:")
+		value("cpu", quantity(r.CurrentRequestCPU, cpuQuantity), quantity(r.RequestCPU, cpuQuantity))
+		value("memory", quantity(r.CurrentRequestMem, memoryQuantity), quantity(r.RequestMem, memoryQuantity))
+		line(" ", "  limits:")
+		value("cpu", quantity(r.CurrentLimitCPU, cpuQuantity), quantity(r.LimitCPU, cpuQuantity))
+		value("memory", quantity(r.CurrentLimitMem, memoryQuantity), quantity(r.LimitMem, memoryQuantity))
+	}
+	return nil
+}
+
+// addRecommendation writes the recommendation to the stream or keeps it until the end of the analysis
+func (o *Options) addRecommendation(rec Recommendation) {
+	if o.stream == nil {
+		o.recommendations = append(o.recommendations, rec)
+		return
+	}
+	err := o.stream.Encode(rec)
+	if err != nil {
+		glog.Errorf("could not write recommendation of %s %s: %v", rec.Workload, rec.Container, err)
+	}
+	o.streamed++
+	if _, ok := o.streamedSavings[rec.Workload]; !ok {
+		o.streamedWorkloads = append(o.streamedWorkloads, rec.Workload)
+	}
+	o.streamedSavings[rec.Workload] = o.streamedSavings[rec.Workload].add(rec.CPUSavings, rec.MemSavings)
+}
+
+// streamRows drops the table entries of the workload when the recommendations are streamed, so the memory stays flat
+func (o *Options) streamRows(data []tableEntry, start int) []tableEntry {
+	if o.stream == nil {
+		return data
+	}
+	return data[:start]
+}
+
+// streamSummary is the last record of the jsonl output
+func (o *Options) streamSummary() map[string]interface{} {
+	return map[string]interface{}{
+		"summary": map[string]interface{}{
+			"version":         Version,
+			"recommendations": o.streamed,
+			"cpuSavings":      o.totalCPUSave,
+			"memorySavings":   o.totalMemSave,
+			"reclaimCPU":      o.totals.ReclaimCPU,
+			"addCPU":          o.totals.AddCPU,
+			"reclaimMemory":   o.totals.ReclaimMem,
+			"addMemory":       o.totals.AddMem,
+		},
+	}
+}
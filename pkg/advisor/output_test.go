@@ -0,0 +1,41 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerPolicy(t *testing.T) {
+	r := Recommendation{
+		Container:   "app",
+		RequestCPU:  0.5,
+		RequestMem:  512 * 1024 * 1024,
+		LimitCPU:    1,
+		LimitMem:    gib,
+		MinUsageCPU: 0.05,
+		MinUsageMem: 128 * 1024 * 1024,
+	}
+	// the floor is the lowest observed usage, not the suggested request
+	want := map[string]interface{}{
+		"containerName": "app",
+		"minAllowed":    map[string]string{"cpu": "50m", "memory": "128Mi"},
+		"maxAllowed":    map[string]string{"cpu": "1", "memory": "1Gi"},
+	}
+	if got := containerPolicy(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("containerPolicy() = %v, want %v", got, want)
+	}
+
+	r.MinUsageCPU, r.MinUsageMem = 0, 0
+	if got := containerPolicy(r)["minAllowed"]; !reflect.DeepEqual(got, map[string]string{}) {
+		t.Errorf("containerPolicy() without usage minAllowed = %v, want none", got)
+	}
+}
+
+func TestFloat64Min(t *testing.T) {
+	if got := float64Min([]float64{0.3, 0.1, 0.2}); got != 0.1 {
+		t.Errorf("float64Min() = %g, want 0.1", got)
+	}
+	if got := float64Min(nil); got != 0 {
+		t.Errorf("float64Min(nil) = %g, want 0", got)
+	}
+}
@@ -0,0 +1,78 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// matchingPDBs returns the PodDisruptionBudgets selecting the pods of the template
+func matchingPDBs(pdbs []policyv1.PodDisruptionBudget, template v1.PodTemplateSpec) []policyv1.PodDisruptionBudget {
+	output := []policyv1.PodDisruptionBudget{}
+	for _, pdb := range pdbs {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(template.Labels)) {
+			output = append(output, pdb)
+		}
+	}
+	return output
+}
+
+// pdbStrict returns true if the budget does not allow any pod of the workload to be unavailable
+func pdbStrict(pdb policyv1.PodDisruptionBudget, replicas int32) bool {
+	if pdb.Spec.MaxUnavailable != nil {
+		value, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MaxUnavailable, int(replicas), true)
+		return err == nil && value == 0
+	}
+	if pdb.Spec.MinAvailable != nil {
+		value, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MinAvailable, int(replicas), true)
+		return err == nil && value >= int(replicas)
+	}
+	return false
+}
+
+// listPDBs returns the PodDisruptionBudgets of the namespace, they are checked for every output and only shown in
+// wide output. The result is nil when the PDBs are not known, e.g. the user may not list them.
+func (o *Options) listPDBs(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+	list, err := o.client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if apierrors.IsForbidden(err) {
+		o.warnOnce("pdb", fmt.Sprintf("could not list the PodDisruptionBudgets, strict PDBs are not checked: %v", err))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// checkPDB records the PDBs of the workload in its table entries and warns when a downsized workload has a strict PDB.
+func (o *Options) checkPDB(data []tableEntry, start int, pdbs []policyv1.PodDisruptionBudget, namespace string, resource string, template v1.PodTemplateSpec, replicas int32, cpuSave float64, memSave float64) []tableEntry {
+	names := []string{}
+	strict := false
+	for _, pdb := range matchingPDBs(pdbs, template) {
+		if pdbStrict(pdb, replicas) {
+			strict = true
+			names = append(names, fmt.Sprintf("%s (strict)", pdb.Name))
+		} else {
+			names = append(names, pdb.Name)
+		}
+	}
+
+	if strict && (cpuSave > 0 || memSave > 0) {
+		o.addDiagnostic(severityWarning, categoryDisruptionBudget, namespace, resource, "", "Strict PodDisruptionBudget, downsizing may make rolling updates unschedulable on a constrained cluster")
+	}
+
+	for i := start; i < len(data); i++ {
+		data[i].pdbs, data[i].pdbsListed = names, pdbs != nil
+	}
+	return data
+}
@@ -0,0 +1,42 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestStrictPDBWarningWithoutWideOutput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/policy/v1/namespaces/shop/poddisruptionbudgets" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind": "PodDisruptionBudgetList", "apiVersion": "policy/v1", "items": [
+			{"metadata": {"name": "cart", "namespace": "shop"}, "spec": {"maxUnavailable": 0, "selector": {"matchLabels": {"app": "cart"}}}}]}`)
+	}))
+	t.Cleanup(server.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{Output: outputTable, client: client}
+	pdbs, err := o.listPDBs(context.Background(), "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "cart"}}}
+	o.checkPDB(nil, 0, pdbs, "shop", "deployment/cart", template, 2, 1, 0)
+	if len(o.diagnostics) != 1 || o.diagnostics[0].Category != categoryDisruptionBudget {
+		t.Errorf("diagnostics = %+v, want the strict PDB warning", o.diagnostics)
+	}
+}
@@ -0,0 +1,48 @@
+package advisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// presets are the flag values of the --profile presets, balanced keeps the defaults
+var presets = map[string]map[string]string{
+	"aggressive": {
+		"quantile":           "0.9",
+		"limit-margin":       "0.1",
+		"decrease-threshold": "90",
+	},
+	"balanced": {},
+	"conservative": {
+		"quantile":           "0.99",
+		"limit-margin":       "0.5",
+		"decrease-threshold": "70",
+	},
+}
+
+// applyPreset sets the flags of the --profile preset, flags given on the command line or in the config file win
+func applyPreset(cmd *cobra.Command, name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		names := []string{}
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile '%s', supported values are %s", name, strings.Join(names, ", "))
+	}
+	flags := cmd.Flags()
+	for key, value := range preset {
+		if flags.Changed(key) {
+			continue
+		}
+		err := flags.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("invalid value of '%s' in profile %s: %v", key, name, err)
+		}
+	}
+	return nil
+}
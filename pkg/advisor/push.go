@@ -0,0 +1,66 @@
+package advisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pushJob = "resource-advisor"
+
+// pushTimeout bounds the push of the metrics, an unresponsive pushgateway must not keep the run from exiting
+const pushTimeout = 30 * time.Second
+
+// pushMetrics replaces the metrics of the cluster in the pushgateway with the savings and the analyzed workloads per namespace
+func (o *Options) pushMetrics(ctx context.Context) error {
+	namespaces := []string{}
+	for namespace := range o.namespaceWorkloads {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	// the text exposition format, the metric families must not be split
+	var body bytes.Buffer
+	gauge := func(name string, help string, value func(namespace string) float64) {
+		fmt.Fprintf(&body, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, namespace := range namespaces {
+			fmt.Fprintf(&body, "%s{namespace=%s} %s\n", name, strconv.Quote(namespace), strconv.FormatFloat(value(namespace), 'f', -1, 64))
+		}
+	}
+	gauge("resource_advisor_total_cpu_savings", "CPU cores that could be saved by applying the suggestions.", func(namespace string) float64 {
+		return o.namespaceCPUSave[namespace]
+	})
+	gauge("resource_advisor_total_mem_savings", "Memory bytes that could be saved by applying the suggestions.", func(namespace string) float64 {
+		return o.namespaceMemSave[namespace]
+	})
+	gauge("resource_advisor_workloads_analyzed", "Workloads analyzed by the last run.", func(namespace string) float64 {
+		return float64(o.namespaceWorkloads[namespace])
+	})
+
+	target := fmt.Sprintf("%s/metrics/job/%s/cluster/%s", strings.TrimSuffix(o.MetricsPush, "/"), pushJob, url.PathEscape(o.ClusterName))
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, &body)
+	if err != nil {
+		return fmt.Errorf("could not push metrics: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not push metrics to %s: %v", o.MetricsPush, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("could not push metrics to %s: %s %s", o.MetricsPush, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package advisor
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// podQOSClass returns the QoS class kubernetes gives to the pods of the spec. Guaranteed pods have cpu and memory
+// limits in every container and requests equal to the limits, a missing request defaults to the limit.
+func podQOSClass(spec v1.PodSpec) v1.PodQOSClass {
+	containers := append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...)
+	guaranteed := true
+	defined := false
+	for _, container := range containers {
+		for _, resource := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			request, hasRequest := container.Resources.Requests[resource]
+			limit, hasLimit := container.Resources.Limits[resource]
+			if (hasRequest && !request.IsZero()) || (hasLimit && !limit.IsZero()) {
+				defined = true
+			}
+			if !hasLimit || limit.IsZero() || (hasRequest && request.Cmp(limit) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case !defined:
+		return v1.PodQOSBestEffort
+	case guaranteed:
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
+
+// setQOS records the QoS class of the pods in the table entries of the workload for the wide output
+func setQOS(data []tableEntry, start int, spec v1.PodSpec) []tableEntry {
+	qos := podQOSClass(spec)
+	for i := start; i < len(data); i++ {
+		data[i].qos = qos
+	}
+	return data
+}
@@ -0,0 +1,74 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// quotaResources are the quota keys limiting the cpu and memory requests of the namespace
+var quotaResources = map[v1.ResourceName][]v1.ResourceName{
+	v1.ResourceCPU:    {v1.ResourceRequestsCPU, v1.ResourceCPU},
+	v1.ResourceMemory: {v1.ResourceRequestsMemory, v1.ResourceMemory},
+}
+
+// quotaExceeded returns the quotas whose projected usage of the resource is over the hard limit.
+// Scoped quotas only count some of the pods and are skipped.
+func quotaExceeded(quotas []v1.ResourceQuota, resource v1.ResourceName, projected func(used float64) float64) []string {
+	output := []string{}
+	for _, quota := range quotas {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for _, name := range quotaResources[resource] {
+			hard, ok := quota.Status.Hard[name]
+			if !ok {
+				continue
+			}
+			used := quota.Status.Used[name]
+			if projected(used.AsApproximateFloat64()) > hard.AsApproximateFloat64() {
+				output = append(output, fmt.Sprintf("%s (%s)", quota.Name, name))
+			}
+		}
+	}
+	return output
+}
+
+// listQuotas returns the ResourceQuotas of the namespace. They only add a check, so the namespace is analyzed
+// also when they can not be listed, the result is then nil and the quotas are not checked.
+func (o *Options) listQuotas(ctx context.Context, namespace string) []v1.ResourceQuota {
+	list, err := o.client.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		o.addDiagnostic(severityWarning, categoryResourceQuota, namespace, "", "", fmt.Sprintf("Could not list the ResourceQuotas, the increases are not checked against them: %v", err))
+		return nil
+	}
+	return list.Items
+}
+
+// checkQuota warns when the increases of the workload would push the namespace requests over its ResourceQuota.
+// The savings of the workloads analyzed before it are applied first, as the suggestions are applied together.
+func (o *Options) checkQuota(data []tableEntry, start int, quotas []v1.ResourceQuota, namespace string, resource string, cpuSave float64, memSave float64) []tableEntry {
+	exceeded := []string{}
+	if cpuSave < 0 {
+		exceeded = append(exceeded, quotaExceeded(quotas, v1.ResourceCPU, func(used float64) float64 {
+			return used - o.namespaceCPUSave[namespace] - cpuSave
+		})...)
+	}
+	if memSave < 0 {
+		exceeded = append(exceeded, quotaExceeded(quotas, v1.ResourceMemory, func(used float64) float64 {
+			return used - o.namespaceMemSave[namespace] - memSave
+		})...)
+	}
+
+	if len(exceeded) > 0 {
+		o.addDiagnostic(severityWarning, categoryResourceQuota, namespace, resource, "", fmt.Sprintf("Increasing the requests would exceed the ResourceQuota %s, the pods would be rejected", strings.Join(exceeded, ", ")))
+	}
+
+	for i := start; i < len(data); i++ {
+		data[i].quotaExceeded, data[i].quotaChecked = exceeded, quotas != nil
+	}
+	return data
+}
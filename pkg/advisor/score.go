@@ -0,0 +1,15 @@
+package advisor
+
+// wasteScore combines the cpu (cores) and memory (GiB) savings of a workload into a single number
+func (o *Options) wasteScore(cpuSave float64, memSave float64) float64 {
+	return o.CPUWeight*cpuSave + o.MemWeight*memSave/(1024*1024*1024)
+}
+
+// setWasteScore records the score of the workload in its table entries, the table is sorted by it with --sort-by score
+func (o *Options) setWasteScore(data []tableEntry, start int, cpuSave float64, memSave float64) []tableEntry {
+	score := o.wasteScore(cpuSave, memSave)
+	for i := start; i < len(data); i++ {
+		data[i].score = score
+	}
+	return data
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -20,14 +21,23 @@ func init() {
 func Execute() {
 	options := &Options{}
 	flag.Lookup("logtostderr").Value.Set("true")
-	glog.Infof("Starting application...\n")
+	glog.Infof("Starting application %s...\n", Version)
 	glog.Flush()
 	rootCmd := &cobra.Command{
 		Use:   "resource-advisor",
 		Short: "Kubernetes resource-advisor",
 		Long:  "Kubernetes resource-advisor",
 		Run: func(cmd *cobra.Command, args []string) {
-			err := Run(options)
+			var err error
+			if options.Config != "" {
+				err = loadConfig(cmd, options.Config)
+			}
+			if err == nil && options.Profile != "" {
+				err = applyPreset(cmd, options.Profile)
+			}
+			if err == nil {
+				err = Run(options)
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "\n%v\n", err)
 				os.Exit(1)
@@ -38,8 +48,101 @@ func Execute() {
 
 	rootCmd.Flags().StringVar(&options.NamespaceInput, "namespaces", "", "Comma separated namespaces to be scanned")
 	rootCmd.Flags().StringVar(&options.NamespaceSelector, "namespace-selector", "", "Namespace selector")
-	rootCmd.Flags().StringVar(&options.Quantile, "quantile", "0.95", "Quantile to be used")
-	rootCmd.Flags().StringVar(&options.LimitMargin, "limit-margin", "1.2", "Limit margin")
+	rootCmd.Flags().BoolVarP(&options.AllNamespaces, "all-namespaces", "A", false, "Scan all namespaces, --namespaces is ignored")
+	rootCmd.Flags().StringVar(&options.NamespaceExclude, "namespace-exclude", "", "Comma separated namespaces to skip, supports globs, e.g. kube-*,monitoring")
+	rootCmd.Flags().StringVarP(&options.Selector, "selector", "l", "", "Label selector of the workloads to be analyzed, e.g. team=payments")
+	rootCmd.Flags().StringVar(&options.NameFilter, "name-filter", "", "Regular expression the workload names must match, e.g. -api$")
+	rootCmd.Flags().StringVar(&options.OnlyContainers, "only-containers", "", "Comma separated container names or regular expressions to analyze, e.g. app,worker-.*")
+	rootCmd.Flags().StringVar(&options.ExcludeContainers, "exclude-containers", "", "Comma separated container names or regular expressions to skip, e.g. istio-proxy,linkerd-proxy")
+	rootCmd.Flags().StringVar(&options.Quantile, "quantile", "0.95", "Quantile of the usage used for request suggestions, empty uses the average")
+	rootCmd.Flags().StringVar(&options.RequestStrategy, "request-strategy", "quantile", "Strategy used for request suggestions: quantile or peak-hour")
+	rootCmd.Flags().StringVar(&options.RequestAggregation, "request-aggregation", "quantile", "Aggregation of the usage over the window for request suggestions: avg, max or quantile (uses --quantile)")
+	rootCmd.Flags().StringVar(&options.LimitAggregation, "limit-aggregation", "max", "Aggregation of the usage over the window for limit suggestions: avg, max or quantile (uses --quantile)")
+	rootCmd.Flags().StringVar(&options.Window, "window", "1w", "Prometheus lookback window, e.g. 24h, 7d or 30d")
+	rootCmd.Flags().StringVar(&options.RecentWindow, "recent-window", "", "Short window whose request suggestions are blended with the ones of --history-window, e.g. 1d")
+	rootCmd.Flags().StringVar(&options.HistoryWindow, "history-window", "", "Long window of the request blend, defaults to --window")
+	rootCmd.Flags().Float64Var(&options.RecentWeight, "recent-weight", 0.5, "Weight of the recent window in the request blend, the history window gets the rest")
+	rootCmd.Flags().StringVar(&options.At, "at", "", "Evaluate the window ending at this time instead of now (RFC3339)")
+	rootCmd.Flags().StringVar(&options.Since, "since", "", "Start of an explicit time range used instead of the window (RFC3339)")
+	rootCmd.Flags().StringVar(&options.Until, "until", "", "End of the time range given with --since, defaults to now (RFC3339)")
+	rootCmd.Flags().Float64Var(&options.LimitMargin, "limit-margin", 0.2, "Headroom added on top of the peak usage for limit suggestions, 0.2 means +20%")
+	rootCmd.Flags().StringVar(&options.ReferenceDeployment, "reference-deployment", "", "Use the container usage of this deployment (namespace/name) for the suggestions")
+	rootCmd.Flags().StringVar(&options.CPUMetric, "cpu-metric", cpuUsageSeries, "Prometheus expression of the container cpu usage in cores, %s is replaced with the pod selector")
+	rootCmd.Flags().StringVar(&options.MemMetric, "mem-metric", memoryUsageSeries, "Prometheus expression of the container memory usage in bytes, %s is replaced with the pod selector")
+	rootCmd.Flags().BoolVar(&options.RequireMetrics, "require-metrics", false, "Fail if the required prometheus metrics do not exist")
+	rootCmd.Flags().StringVar(&options.IgnoreCPUBelow, "ignore-cpu-below", "", "Do not suggest decreasing cpu requests of containers using less than this (e.g. 5m)")
+	rootCmd.Flags().StringVar(&options.MinCPUSavings, "min-cpu-savings", "", "Hide containers whose cpu savings of all replicas are smaller than this (e.g. 100m)")
+	rootCmd.Flags().StringVar(&options.MinMemSavings, "min-mem-savings", "", "Hide containers whose memory savings of all replicas are smaller than this (e.g. 256Mi)")
+	rootCmd.Flags().StringVar(&options.CacheDir, "cache-dir", "", "Directory for caching prometheus query results between runs")
+	rootCmd.Flags().DurationVar(&options.CacheTTL, "cache-ttl", time.Hour, "How long cached prometheus query results are used")
+	rootCmd.Flags().BoolVar(&options.NoCache, "no-cache", false, "Do not use the prometheus query cache")
+	rootCmd.Flags().Float64Var(&options.DriftThreshold, "drift-threshold", 2.0, "Ratio between current and suggested requests that is considered drift")
+	rootCmd.Flags().BoolVar(&options.FailOnDrift, "fail-on-drift", false, "Exit with non-zero code if any container drifts more than drift-threshold")
+	rootCmd.Flags().BoolVar(&options.ByImage, "by-image", false, "Break down deployment usage per container image seen during the window")
+	rootCmd.Flags().StringVar(&options.ByLabel, "by-label", "", "Break down deployment usage per value of this pod label, e.g. version (the label must be exported by kube-state-metrics)")
+	rootCmd.Flags().Int32Var(&options.Replicas, "replicas", 0, "What-if replica count of the deployments used for the savings and the footprint instead of the live spec.replicas")
+	rootCmd.Flags().BoolVar(&options.IncludeScaledDown, "include-scaled-down", false, "Suggest resources for deployments scaled to zero from their historical usage")
+	rootCmd.Flags().BoolVar(&options.IncludeRolling, "include-rolling", false, "Analyze deployments with a rollout in progress")
+	rootCmd.Flags().StringVar(&options.EnvProfile, "env-profile", "", "Comma separated environment profiles to produce suggestions for, e.g. dev,prod")
+	rootCmd.Flags().StringToStringVar(&options.EnvMultipliers, "env-multipliers", map[string]string{"dev": "1.0", "staging": "1.2", "prod": "1.5"}, "Suggestion multipliers of the environment profiles")
+	rootCmd.Flags().StringVarP(&options.Output, "output", "o", "table", "Output format: table, wide, json, yaml, csv, kubecost-csv, vpa, diff, html or jsonl (streamed while analyzing)")
+	rootCmd.Flags().StringVar(&options.OutputFile, "output-file", "", "Write the report to this file instead of stdout")
+	rootCmd.Flags().BoolVar(&options.WasteScore, "waste-score", false, "Show a combined cpu and memory waste score per workload")
+	rootCmd.Flags().Float64Var(&options.CPUWeight, "cpu-weight", 1.0, "Weight of one vCPU of savings in the waste score")
+	rootCmd.Flags().Float64Var(&options.MemWeight, "mem-weight", 1.0, "Weight of one GiB of memory savings in the waste score")
+	rootCmd.Flags().StringVar(&options.SortBy, "sort-by", "", "Sort the rows, supported value: score")
+	rootCmd.Flags().StringVar(&options.ClusterName, "cluster-name", "", "Cluster name used in the output, defaults to the kubeconfig context")
+	rootCmd.Flags().Float64Var(&options.OverUtilizedAbove, "over-utilized-above", 0, "Only show containers using more than this ratio (e.g. 0.9) of their current request or limit")
+	rootCmd.Flags().BoolVar(&options.Apply, "apply", false, "Patch the workloads with the suggested resources")
+	rootCmd.Flags().StringVar(&options.ByteUnits, "byte-units", "binary", "Units of the memory totals: binary (MiB, GiB) like the kubernetes quantities or si (MB, GB)")
+	rootCmd.Flags().BoolVar(&options.PreserveQOS, "preserve-qos", false, "Suggest requests equal to the limits for the containers of Guaranteed QoS pods")
+	rootCmd.Flags().BoolVar(&options.Interactive, "interactive", false, "Review the suggestions one by one before applying the accepted ones, implies --apply")
+	rootCmd.Flags().BoolVar(&options.DryRun, "dry-run", true, "Only do a server side dry run of the apply, use --dry-run=false to change the workloads")
+	rootCmd.Flags().IntVar(&options.Concurrency, "concurrency", 8, "How many pods are queried from prometheus in parallel")
+	rootCmd.Flags().StringVar(&options.PrometheusURL, "prometheus-url", "", "Prometheus url, by default prometheus-operated in monitoring namespace is used through the api proxy")
+	rootCmd.Flags().StringVar(&options.PrometheusUsername, "prometheus-username", "", "Basic auth username of the prometheus given in --prometheus-url")
+	rootCmd.Flags().StringVar(&options.PrometheusPassword, "prometheus-password", "", "Basic auth password of the prometheus given in --prometheus-url")
+	rootCmd.Flags().StringVar(&options.PrometheusToken, "prometheus-token", "", "Bearer token of the prometheus given in --prometheus-url")
+	rootCmd.Flags().StringVar(&options.PrometheusTokenFile, "prometheus-token-file", "", "File containing the bearer token of the prometheus given in --prometheus-url")
+	rootCmd.Flags().StringVar(&options.Backend, "backend", "prometheus", "Metrics backend: prometheus, thanos or metrics-server (current usage only, less accurate)")
+	rootCmd.Flags().BoolVar(&options.Dedup, "dedup", true, "Deduplicate replicated series, only used with thanos backend")
+	rootCmd.Flags().BoolVar(&options.PartialResponse, "partial-response", false, "Allow partial responses when some stores are unavailable, only used with thanos backend")
+	rootCmd.Flags().BoolVar(&options.IncludeBarePods, "include-bare-pods", false, "Suggest resources also for running pods without a deployment, statefulset or daemonset")
+	rootCmd.Flags().Float64Var(&options.DecreaseThreshold, "decrease-threshold", decreaseThreshold, "Percentage of the current value a suggestion must be below to be applied. Only used by --apply, --interactive and --changes-only, the report shows every suggestion")
+	rootCmd.Flags().Float64Var(&options.IncreaseThreshold, "increase-threshold", increaseThreshold, "Percentage of the current value a suggestion must be above to be applied. Only used by --apply, --interactive and --changes-only, the report shows every suggestion")
+	rootCmd.Flags().IntVar(&options.MinSamples, "min-samples", 0, "Skip containers having less cpu usage data points than this during the window")
+	rootCmd.Flags().DurationVar(&options.Timeout, "timeout", 0, "Timeout of a single prometheus query, 0 means no timeout")
+	rootCmd.Flags().DurationVar(&options.Deadline, "deadline", 0, "Deadline of the whole run, the results gathered until then are printed. 0 means no deadline")
+	rootCmd.Flags().Float64Var(&options.CPUCost, "cpu-cost", 0, "Price of one vCPU per month, used to estimate the savings in money")
+	rootCmd.Flags().Float64Var(&options.MemCost, "mem-cost", 0, "Price of one GiB of memory per month, used to estimate the savings in money")
+	rootCmd.Flags().BoolVar(&options.Peak, "peak", false, "Suggest limits from the highest usage in the time series of the window and show when it happened")
+	// glog flags, e.g. -v 4 logs every prometheus query
+	rootCmd.Flags().AddGoFlagSet(flag.CommandLine)
+	rootCmd.Flags().StringVar(&options.FailOverCPU, "fail-over-cpu", "", "Exit with non-zero code if any workload could save more cpu than this (e.g. 2)")
+	rootCmd.Flags().StringVar(&options.FailOverMem, "fail-over-mem", "", "Exit with non-zero code if any workload could save more memory than this (e.g. 4Gi)")
+	rootCmd.Flags().StringVar(&options.FromFile, "from-file", "", "Analyze the deployments of a manifest file or directory instead of the cluster, usage is found by the pod names")
+	rootCmd.Flags().StringVar(&options.MetricGranularity, "metric-granularity", granularityContainer, "Resolution of the usage metrics: container, or pod when the cluster only exposes the usage of the pods")
+	rootCmd.Flags().StringVar(&options.PodAggregation, "pod-aggregation", "max", "How the request suggestions of the pods of a workload are combined: avg, max or p95")
+	rootCmd.Flags().StringVar(&options.CPURound, "cpu-round", "100m", "Round the cpu suggestions up to a multiple of this (e.g. 10m, 50m, 100m)")
+	rootCmd.Flags().StringVar(&options.MemRound, "mem-round", "100Mi", "Round the memory suggestions up to a multiple of this (e.g. 64Mi, 128Mi, 256Mi)")
+	rootCmd.Flags().StringVar(&options.CPUFloor, "cpu-floor", "", "Never suggest cpu requests or limits below this (e.g. 50m)")
+	rootCmd.Flags().StringVar(&options.MemFloor, "mem-floor", "", "Never suggest memory requests or limits below this (e.g. 128Mi)")
+	rootCmd.Flags().BoolVar(&options.FailFast, "fail-fast", false, "Stop at the first workload that can not be analyzed instead of reporting the errors at the end")
+	rootCmd.Flags().Float64Var(&options.QueryRate, "query-rate", 0, "Maximum prometheus queries per second, 0 means unlimited")
+	rootCmd.Flags().StringVar(&options.GPUMetric, "gpu-metric", "", "GPU utilization metric template with %s for the pod selector, e.g. DCGM_FI_DEV_GPU_UTIL{%s}. Warns about containers requesting unused GPUs")
+	rootCmd.Flags().StringVar(&options.GPUResource, "gpu-resource", "nvidia.com/gpu", "Extended resource name of the GPUs, e.g. amd.com/gpu")
+	rootCmd.Flags().StringVar(&options.MetricsPush, "metrics-push", "", "Pushgateway URL to push the savings and the analyzed workloads per namespace to after the run")
+	rootCmd.Flags().StringVar(&options.WebhookURL, "webhook-url", "", "Slack incoming webhook URL to post a digest of the savings to after the run")
+	rootCmd.Flags().IntVar(&options.WebhookTop, "webhook-top", 5, "How many workloads with the biggest savings are listed in the webhook digest")
+	rootCmd.Flags().StringVar(&options.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, the KUBECONFIG environment variable and ~/.kube/config are used by default")
+	rootCmd.Flags().StringVar(&options.Context, "context", "", "Kubeconfig context to use instead of the current context")
+	rootCmd.Flags().BoolVar(&options.ChangesOnly, "changes-only", false, "Hide the containers whose requests and limits would not change beyond --decrease-threshold and --increase-threshold")
+	rootCmd.Flags().Float64Var(&options.ThrottleThreshold, "throttle-threshold", 0.25, "Raise the cpu limit of containers throttled in more than this share of the cfs periods (e.g. 0.25), 0 disables the check")
+	rootCmd.Flags().BoolVar(&options.DropCPULimits, "drop-cpu-limits", false, "Suggest removing the cpu limits instead of a value to avoid throttling, Guaranteed pods keep theirs with --preserve-qos")
+	rootCmd.Flags().BoolVar(&options.NamespaceSummary, "namespace-summary", false, "Print the current and suggested requests per namespace, the biggest opportunity first")
+	rootCmd.Flags().StringVar(&options.Profile, "profile", "", "Preset of the quantile, limit margin and decrease threshold: aggressive, balanced or conservative. Individual flags override it")
+	rootCmd.Flags().StringVar(&options.Config, "config", "", "YAML file setting the options by their flag names, e.g. window: 7d. Command line flags override it")
+	rootCmd.AddCommand(newVersionCommand())
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
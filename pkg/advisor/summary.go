@@ -0,0 +1,56 @@
+package advisor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// addNamespaceTotal adds the current and suggested requests of the workload pods to its namespace, cpu in cores and memory in bytes
+func (o *Options) addNamespaceTotal(namespace string, currentCPU float64, suggestedCPU float64, currentMem float64, suggestedMem float64) {
+	total := o.namespaceTotals[namespace]
+	total.Workloads++
+	total.CurrentCPU += currentCPU
+	total.SuggestedCPU += suggestedCPU
+	total.CurrentMem += currentMem
+	total.SuggestedMem += suggestedMem
+	o.namespaceTotals[namespace] = total
+}
+
+// printNamespaceSummary prints the current and suggested requests per namespace, the biggest waste score first
+func (o *Options) printNamespaceSummary(w io.Writer) {
+	namespaces := []string{}
+	for namespace := range o.namespaceTotals {
+		namespaces = append(namespaces, namespace)
+	}
+	score := func(t namespaceTotal) float64 {
+		return o.wasteScore(t.CurrentCPU-t.SuggestedCPU, t.CurrentMem-t.SuggestedMem)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		a, b := score(o.namespaceTotals[namespaces[i]]), score(o.namespaceTotals[namespaces[j]])
+		if a != b {
+			return a > b
+		}
+		return namespaces[i] < namespaces[j]
+	})
+
+	fmt.Fprintf(w, "Requests per namespace:\n")
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Namespace", "Workloads", "Request CPU (current)", "Request CPU (suggested)", "Request MEM (current)", "Request MEM (suggested)", "CPU Savings", "MEM Savings"})
+	for _, namespace := range namespaces {
+		t := o.namespaceTotals[namespace]
+		table.Append([]string{
+			namespace,
+			fmt.Sprintf("%d", t.Workloads),
+			fmt.Sprintf("%.2f", t.CurrentCPU),
+			fmt.Sprintf("%.2f", t.SuggestedCPU),
+			o.byteCount(int64(t.CurrentMem)),
+			o.byteCount(int64(t.SuggestedMem)),
+			signedCores(t.CurrentCPU - t.SuggestedCPU),
+			o.signedBytes(t.CurrentMem - t.SuggestedMem),
+		})
+	}
+	table.Render()
+}
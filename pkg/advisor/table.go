@@ -0,0 +1,116 @@
+package advisor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	apresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// tableEntry is a container of the table output, its recommendation or the reason why it got none, and what the
+// wide output shows of its workload. Analyze only collects the entries, Run formats them into rows.
+type tableEntry struct {
+	workload Workload
+	// container is the name shown for the containers without a recommendation
+	container string
+	resources v1.ResourceRequirements
+	rec       *Recommendation
+	reason    string
+	qos       v1.PodQOSClass
+	// pdbs are the names of the PodDisruptionBudgets of the workload, unknown when they were not listed
+	pdbs       []string
+	pdbsListed bool
+	// quotaExceeded are the ResourceQuotas the increases of the workload would exceed
+	quotaExceeded []string
+	quotaChecked  bool
+	score         float64
+}
+
+// recommendationEntry is the table entry of a container with a recommendation, the resources are its current spec
+func recommendationEntry(rec Recommendation, resources v1.ResourceRequirements) tableEntry {
+	return tableEntry{workload: rec.Workload, container: rec.Container, resources: resources, rec: &rec}
+}
+
+// tableRows formats the entries as the rows of the table output, by waste score with --sort-by score
+func (o *Options) tableRows(entries []tableEntry) [][]string {
+	if o.SortBy == sortByScore {
+		entries = append([]tableEntry{}, entries...)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].score > entries[j].score
+		})
+	}
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		row := entry.row()
+		if o.Output == outputWide {
+			row = append(row, string(entry.qos), entry.pdbColumn(), entry.quotaColumn())
+		}
+		if o.WasteScore {
+			row = append(row, fmt.Sprintf("%.2f", entry.score))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// row returns the columns of the suggestions, the current values of the spec are in parentheses
+func (e tableEntry) row() []string {
+	w := e.workload
+	if e.rec == nil {
+		return []string{w.Namespace, w.String(), e.container, e.reason, e.reason, e.reason, e.reason, "-", "-"}
+	}
+
+	rec := e.rec
+	name := rec.Container
+	if rec.Init {
+		name = fmt.Sprintf("%s (init)", name)
+	}
+	if rec.OOMKilled {
+		name = fmt.Sprintf("%s (OOM observed)", name)
+	}
+	if rec.Throttled {
+		name = fmt.Sprintf("%s (throttled)", name)
+	}
+	reqCpu := int(math.Round(rec.RequestCPU * 1000))
+	reqMem := int(math.Round(rec.RequestMem / 1024 / 1024))
+	limCpu := int(math.Round(rec.LimitCPU * 1000))
+	limMem := int(math.Round(rec.LimitMem / 1024 / 1024))
+	_, strReqCPU := currentValue(e.resources, "request", v1.ResourceCPU, reqCpu, apresource.DecimalSI)
+	_, strReqMem := currentValue(e.resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
+	_, strLimCPU := currentValue(e.resources, "limit", v1.ResourceCPU, limCpu, apresource.DecimalSI)
+	_, strLimMem := currentValue(e.resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
+	return []string{
+		w.Namespace,
+		w.String(),
+		name,
+		fmt.Sprintf("%dm (%s)", reqCpu, strReqCPU),
+		fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
+		cpuLimitCell(limCpu, strLimCPU, rec.DropCPULimit),
+		fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
+		formatSavings(math.Round(rec.CPUSavings*1000), "m"),
+		formatSavings(math.Round(rec.MemSavings/1024/1024), "Mi"),
+	}
+}
+
+func (e tableEntry) pdbColumn() string {
+	if !e.pdbsListed {
+		return "unknown"
+	}
+	if len(e.pdbs) == 0 {
+		return "-"
+	}
+	return strings.Join(e.pdbs, ", ")
+}
+
+func (e tableEntry) quotaColumn() string {
+	if !e.quotaChecked {
+		return "not checked"
+	}
+	if len(e.quotaExceeded) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("exceeds %s", strings.Join(e.quotaExceeded, ", "))
+}
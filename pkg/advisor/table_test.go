@@ -0,0 +1,46 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestTableRows(t *testing.T) {
+	resources := v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: apresource.MustParse("500m"), v1.ResourceMemory: apresource.MustParse("1Gi")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: apresource.MustParse("2Gi")},
+	}
+	cart := Workload{Namespace: "shop", Kind: "deployment", Name: "cart"}
+	checkout := Workload{Namespace: "shop", Kind: "deployment", Name: "checkout"}
+	suggested := recommendationEntry(Recommendation{
+		Workload:   cart,
+		Container:  "app",
+		RequestCPU: 0.2,
+		RequestMem: 256 * 1024 * 1024,
+		LimitCPU:   0.3,
+		LimitMem:   512 * 1024 * 1024,
+		CPUSavings: 0.6,
+		MemSavings: 1536 * 1024 * 1024,
+		OOMKilled:  true,
+	}, resources)
+	suggested.qos, suggested.pdbs, suggested.pdbsListed, suggested.quotaChecked, suggested.score = v1.PodQOSBurstable, []string{"cart"}, true, true, 1
+	missing := tableEntry{workload: checkout, container: "app", reason: "no metrics", qos: v1.PodQOSBestEffort, score: 2}
+
+	o := &Options{Output: outputWide, WasteScore: true, SortBy: sortByScore}
+	want := [][]string{
+		{"shop", "deployment/checkout", "app", "no metrics", "no metrics", "no metrics", "no metrics", "-", "-", "BestEffort", "unknown", "not checked", "2.00"},
+		{"shop", "deployment/cart", "app (OOM observed)", "200m (500m)", "256Mi (1Gi)", "300m (<nil>)", "512Mi (2Gi)", "600m", "1536Mi", "Burstable", "cart", "-", "1.00"},
+	}
+	if got := o.tableRows([]tableEntry{suggested, missing}); !reflect.DeepEqual(got, want) {
+		t.Errorf("tableRows() = %q, want %q", got, want)
+	}
+
+	// the default output has neither the wide columns nor the score
+	o = &Options{Output: outputTable}
+	if got := o.tableRows([]tableEntry{suggested}); len(got[0]) != 9 {
+		t.Errorf("tableRows() = %q, want 9 columns", got)
+	}
+}
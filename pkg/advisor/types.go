@@ -1,31 +1,213 @@
 package advisor
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sync"
+	"time"
 
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 type Options struct {
-	NamespaceInput    string
-	NamespaceSelector string
-	Namespaces        string
-	Quantile          string
-	LimitMargin       string
-	promClient        *promClient
-	client            *kubernetes.Clientset
+	NamespaceInput      string
+	NamespaceSelector   string
+	AllNamespaces       bool
+	NamespaceExclude    string
+	Selector            string
+	NameFilter          string
+	nameFilter          *regexp.Regexp
+	OnlyContainers      string
+	onlyContainers      *regexp.Regexp
+	ExcludeContainers   string
+	excludeContainers   *regexp.Regexp
+	Namespaces          string
+	Quantile            string
+	RequestStrategy     string
+	RequestAggregation  string
+	LimitAggregation    string
+	LimitMargin         float64
+	Window              string
+	window              time.Duration
+	RequireMetrics      bool
+	ReferenceDeployment string
+	IgnoreCPUBelow      string
+	ignoreCPUBelow      int64
+	MinCPUSavings       string
+	minCPUSavings       float64
+	MinMemSavings       string
+	minMemSavings       float64
+	hiddenContainers    int
+	ChangesOnly         bool
+	wellSizedContainers int
+	skipped             []string
+	skippedContainers   map[string]bool
+	warned              map[string]bool
+	// stream writes the recommendations as they are found with --output jsonl, nil collects them
+	stream   *json.Encoder
+	streamed int
+	// streamedWorkloads and streamedSavings are the savings per workload of the streamed recommendations, for the webhook
+	streamedWorkloads   []Workload
+	streamedSavings     map[Workload]savings
+	analyzed            map[string]int
+	noMetrics           map[string]bool
+	namespaceWorkloads  map[string]int
+	MetricsPush         string
+	Kubeconfig          string
+	Context             string
+	FailFast            bool
+	workloadErrors      []string
+	QueryRate           float64
+	CacheDir            string
+	CacheTTL            time.Duration
+	NoCache             bool
+	DriftThreshold      float64
+	FailOnDrift         bool
+	drifts              []string
+	ByImage             bool
+	ByLabel             string
+	GPUResource         string
+	GPUMetric           string
+	IncludeScaledDown   bool
+	Replicas            int32
+	IncludeRolling      bool
+	rolling             []string
+	diagnostics         []diagnostic
+	EnvProfile          string
+	EnvMultipliers      map[string]string
+	envProfiles         []string
+	envMultipliers      map[string]float64
+	profileCPUSave      map[string]float64
+	profileMemSave      map[string]float64
+	profileSavings      map[string]savings
+	Output              string
+	OutputFile          string
+	WasteScore          bool
+	CPUWeight           float64
+	MemWeight           float64
+	SortBy              string
+	ClusterName         string
+	recommendations     []Recommendation
+	entries             []tableEntry
+	imageRows           [][]string
+	totalCPUSave        float64
+	totalMemSave        float64
+	namespaceCPUSave    map[string]float64
+	namespaceMemSave    map[string]float64
+	totals              savings
+	partial             bool
+	OverUtilizedAbove   float64
+	Apply               bool
+	DryRun              bool
+	Interactive         bool
+	PreserveQOS         bool
+	ByteUnits           string
+	Config              string
+	Profile             string
+	NamespaceSummary    bool
+	DropCPULimits       bool
+	ThrottleThreshold   float64
+	RecentWindow        string
+	HistoryWindow       string
+	RecentWeight        float64
+	WebhookURL          string
+	WebhookTop          int
+	namespaceTotals     map[string]namespaceTotal
+	Concurrency         int
+	PrometheusURL       string
+	Backend             string
+	Dedup               bool
+	PartialResponse     bool
+	IncludeBarePods     bool
+	DecreaseThreshold   float64
+	IncreaseThreshold   float64
+	MinSamples          int
+	Timeout             time.Duration
+	Deadline            time.Duration
+	PrometheusUsername  string
+	PrometheusPassword  string
+	PrometheusToken     string
+	PrometheusTokenFile string
+	At                  string
+	at                  time.Time
+	Since               string
+	since               time.Time
+	Until               string
+	until               time.Time
+	CPUMetric           string
+	MemMetric           string
+	CPUCost             float64
+	MemCost             float64
+	Peak                bool
+	FailOverCPU         string
+	failOverCPU         float64
+	FailOverMem         string
+	failOverMem         float64
+	overBudget          []string
+	FromFile            string
+	fileDeployments     []appsv1.Deployment
+	PodAggregation      string
+	MetricGranularity   string
+	CPURound            string
+	cpuRound            float64
+	MemRound            string
+	memRound            float64
+	CPUFloor            string
+	cpuFloor            float64
+	MemFloor            string
+	memFloor            float64
+	podMetrics          map[string]*podMetricsList
+	podMetricsLock      sync.Mutex
+	promClient          *promClient
+	client              *kubernetes.Clientset
 }
 
 type promClient struct {
 	endpoint *url.URL
 	client   *http.Client
+	cache    *queryCache
+	timeout  time.Duration
+	// username and password or token authenticate to an external prometheus
+	username string
+	password string
+	token    string
+	// params are added to every request, e.g. the dedup option of thanos
+	params url.Values
+	// limiter spaces the queries sent to prometheus, nil means unlimited
+	limiter *rate.Limiter
 }
 
-type suggestion struct {
-	OldValue  float64
-	NewValue  float64
-	Pod       string
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityError
+)
+
+type diagnosticCategory int
+
+const (
+	categoryUndefinedResource diagnosticCategory = iota
+	categoryMissingMetrics
+	categoryDisruptionBudget
+	categoryPeakUsage
+	categoryUnusedGPU
+	categoryResourceQuota
+	categoryCrashLoop
+)
+
+// diagnostic is a finding about a container that is not a resize suggestion
+type diagnostic struct {
+	Severity  severity
+	Category  diagnosticCategory
+	Namespace string
+	Resource  string
 	Container string
 	Message   string
 }
@@ -35,4 +217,92 @@ type prometheusMetrics struct {
 	LimitMem   map[string]float64
 	RequestCPU map[string]float64
 	RequestMem map[string]float64
+	// Samples is the amount of cpu usage data points per container, only queried with --min-samples
+	Samples map[string]float64
+	// CPUPeakAt and MemPeakAt are the times of the peak usage, only known when the series are queried as ranges
+	CPUPeakAt map[string]time.Time
+	MemPeakAt map[string]time.Time
+	// OOMKills is above zero for the containers that were OOM killed during the window
+	OOMKills map[string]float64
+	// Throttled is the highest share of the cfs periods in which a pod of the containers was cpu throttled
+	Throttled map[string]float64
+	// GPUUsage is the highest gpu utilization of the containers, only queried with --gpu-metric
+	GPUUsage map[string]float64
+	// CrashLooping is above zero for the containers in CrashLoopBackOff at the end of the window
+	CrashLooping map[string]float64
+	// MinCPU and MinMem are the lowest usage of the containers during the window, only queried with --output vpa
+	MinCPU map[string]float64
+	MinMem map[string]float64
+}
+
+// Workload identifies the controller of the analyzed containers
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Note      string `json:"note,omitempty"`
+	Profile   string `json:"profile,omitempty"`
+}
+
+// Recommendation is the suggestion for a single container, cpu is in cores and memory in bytes
+type Recommendation struct {
+	Workload          Workload       `json:"workload"`
+	Container         string         `json:"container"`
+	Init              bool           `json:"init,omitempty"`
+	Replicas          float64        `json:"replicas"`
+	CurrentRequestCPU float64        `json:"currentRequestCPU"`
+	CurrentRequestMem float64        `json:"currentRequestMemory"`
+	CurrentLimitCPU   float64        `json:"currentLimitCPU"`
+	CurrentLimitMem   float64        `json:"currentLimitMemory"`
+	RequestCPU        float64        `json:"requestCPU"`
+	RequestMem        float64        `json:"requestMemory"`
+	LimitCPU          float64        `json:"limitCPU"`
+	LimitMem          float64        `json:"limitMemory"`
+	CPUSavings        float64        `json:"cpuSavings"`
+	MemSavings        float64        `json:"memorySavings"`
+	OOMKilled         bool           `json:"oomKilled,omitempty"`
+	Throttled         bool           `json:"throttled,omitempty"`
+	QOSClass          v1.PodQOSClass `json:"qosClass,omitempty"`
+	DropCPULimit      bool           `json:"dropCPULimit,omitempty"`
+	// MinUsageCPU and MinUsageMem are the lowest observed usage, the floor of the vpa recommendation
+	MinUsageCPU float64 `json:"-"`
+	MinUsageMem float64 `json:"-"`
+}
+
+// report is the envelope of the json output
+type report struct {
+	Version         string           `json:"version"`
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+// savings keeps the requests that could be reclaimed apart from the increases, cpu is in cores and memory in bytes
+type savings struct {
+	ReclaimCPU float64
+	AddCPU     float64
+	ReclaimMem float64
+	AddMem     float64
+}
+
+// add adds the net savings of a workload, negative values are increases
+func (s savings) add(cpu float64, mem float64) savings {
+	if cpu > 0 {
+		s.ReclaimCPU += cpu
+	} else {
+		s.AddCPU -= cpu
+	}
+	if mem > 0 {
+		s.ReclaimMem += mem
+	} else {
+		s.AddMem -= mem
+	}
+	return s
+}
+
+// namespaceTotal sums the requests of the analyzed pods of a namespace, cpu is in cores and memory in bytes
+type namespaceTotal struct {
+	Workloads    int
+	CurrentCPU   float64
+	SuggestedCPU float64
+	CurrentMem   float64
+	SuggestedMem float64
 }
@@ -7,10 +7,14 @@ import (
 	"math"
 	"net/http"
 	"net/url"
-	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang/glog"
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	prommodel "github.com/prometheus/common/model"
 	appsv1 "k8s.io/api/apps/v1"
@@ -22,52 +26,144 @@ import (
 )
 
 const (
-	promOperatorClusterURL = "/api/v1/namespaces/monitoring/services/prometheus-operated:web/proxy/"
-	podCPURequest          = `quantile_over_time(%s, node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{pod="%s", container!=""}[1w])`
-	podCPULimit            = `max_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{pod="%s", container!=""}[1w]) * %s`
-	podMemoryRequest       = `quantile_over_time(%s, container_memory_working_set_bytes{pod="%s", container!=""}[1w]) / 1024 / 1024`
-	podMemoryLimit         = `(max_over_time(container_memory_working_set_bytes{pod="%s", container!=""}[1w]) / 1024 / 1024) * %s`
-	deploymentRevision     = "deployment.kubernetes.io/revision"
+	promOperatorClusterURL   = "/api/v1/namespaces/monitoring/services/prometheus-operated:web/proxy/"
+	cpuUsageMetric           = "node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate"
+	memoryUsageMetric        = "container_memory_working_set_bytes"
+	cpuUsageSeries           = cpuUsageMetric + `{%s, container!=""}`
+	memoryUsageSeries        = memoryUsageMetric + `{%s, container!=""}`
+	usageQuantile            = `quantile_over_time(%s, %s)`
+	usageAverage             = `avg_over_time(%s)`
+	usageMax                 = `max_over_time(%s)`
+	usageMin                 = `min_over_time(%s)`
+	podCPULimit              = `%s * %s`
+	podMemoryRequest         = `%s / 1024 / 1024`
+	podMemoryLimit           = `(%s / 1024 / 1024) * %s`
+	podCPURequestPeakHour    = `max_over_time(avg_over_time(%s)[%s:1h])`
+	podMemoryRequestPeakHour = `max_over_time(avg_over_time(%s)[%s:1h]) / 1024 / 1024`
+	podSampleCount           = `count_over_time(%s)`
+	podCrashLooping          = `max by (container) (kube_pod_container_status_waiting_reason{%s, reason="CrashLoopBackOff"})`
+	podOOMKilled             = `max_over_time(kube_pod_container_status_last_terminated_reason{%s, reason="OOMKilled"}[%s])`
+	podGPUUsage              = `max_over_time(%s[%s])`
+	podCPUThrottled          = `rate(container_cpu_cfs_throttled_periods_total{%s, container!=""}[%s]) / (rate(container_cpu_cfs_periods_total{%s, container!=""}[%s]) > 0)`
+	requestStrategyQuantile  = "quantile"
+	requestStrategyPeakHour  = "peak-hour"
+	metricPresence           = `count(%s)`
+	preflightQuery           = `up`
+	deploymentRevision       = "deployment.kubernetes.io/revision"
+	annotationSkip           = "resource-advisor.io/skip"
+	annotationSkipContainer  = "resource-advisor.io/skip-container"
+	outputTable              = "table"
+	outputWide               = "wide"
+	outputJSON               = "json"
+	outputYAML               = "yaml"
+	outputKubecostCSV        = "kubecost-csv"
+	outputVPA                = "vpa"
+	outputCSV                = "csv"
+	outputDiff               = "diff"
+	outputJSONL              = "jsonl"
+	outputHTML               = "html"
+	backendPrometheus        = "prometheus"
+	backendThanos            = "thanos"
+	backendMetricsServer     = "metrics-server"
+	podAggregationAvg        = "avg"
+	podAggregationMax        = "max"
+	podAggregationP95        = "p95"
+	granularityContainer     = "container"
+	granularityPod           = "pod"
+	podCPUUsageSeries        = `sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{%s, container=""}[5m]))`
+	podMemoryUsageSeries     = `sum by (namespace, pod) (container_memory_working_set_bytes{%s, container=""})`
+	aggregationAvg           = "avg"
+	aggregationMax           = "max"
+	aggregationQuantile      = "quantile"
+	byteUnitsSI              = "si"
+	byteUnitsBinary          = "binary"
+	sortByScore              = "score"
+	decreaseThreshold        = 80
+	increaseThreshold        = 110
 )
 
-func findConfig() (*rest.Config, string, error) {
-	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+// kubernetes generates the pod-template-hash and the random suffix of the pod names from these characters,
+// so the pods of other workloads with a similar name are not matched
+const (
+	generatedChars  = "[bcdfghjklmnpqrstvwxz2456789]"
+	generatedSuffix = generatedChars + "{5}"
+)
+
+// clientConfig loads the kubeconfig from --kubeconfig or the default locations, --context replaces the current context
+func (o *Options) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.Kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: o.Context})
+}
+
+func (o *Options) findConfig() (*rest.Config, string, error) {
+	contextName, err := o.currentContext()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := o.clientConfig().RawConfig()
 	if err != nil {
 		return nil, "", err
 	}
 	namespace := ""
-	for k, v := range cfg.Contexts {
-		if cfg.CurrentContext == k {
-			namespace = v.Namespace
-			break
-		}
+	if kubeContext, ok := cfg.Contexts[contextName]; ok {
+		namespace = kubeContext.Namespace
 	}
-	conf, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	conf, err := o.clientConfig().ClientConfig()
 	return conf, namespace, err
 }
 
-func newClientSet() (*kubernetes.Clientset, error) {
-	config, _, err := findConfig()
+// currentContext returns the name of the kubeconfig context in use
+func (o *Options) currentContext() (string, error) {
+	if o.Context != "" {
+		return o.Context, nil
+	}
+	cfg, err := o.clientConfig().RawConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.CurrentContext, nil
+}
+
+func (o *Options) newClientSet() (*kubernetes.Clientset, error) {
+	config, _, err := o.findConfig()
 	if err != nil {
 		return nil, err
 	}
 	return kubernetes.NewForConfig(config)
 }
 
+// queryStatistic returns the highest value of each container over the returned series
 func queryStatistic(ctx context.Context, client *promClient, request string, now time.Time) (map[string]float64, error) {
+	return queryStatisticBy(ctx, client, request, now, float64Peak)
+}
+
+// queryStatisticBy combines the values of the series of each container, every pod has its own series
+func queryStatisticBy(ctx context.Context, client *promClient, request string, now time.Time, aggregate func([]float64) float64) (map[string]float64, error) {
 	output := make(map[string]float64)
 	response, _, err := queryPrometheus(ctx, client, request, now)
 	if err != nil {
 		return output, fmt.Errorf("Error querying statistic %v", err)
 	}
-	asSamples := response.(prommodel.Vector)
 
 	sampleArray := []*prommodel.Sample{}
-	for _, sample := range asSamples {
-		sampleArray = append(sampleArray, sample)
+	switch result := response.(type) {
+	case prommodel.Vector:
+		sampleArray = append(sampleArray, result...)
+	case prommodel.Matrix:
+		// recording rules may return a range, the latest value of each series is used
+		for _, stream := range result {
+			if len(stream.Values) == 0 {
+				continue
+			}
+			last := stream.Values[len(stream.Values)-1]
+			sampleArray = append(sampleArray, &prommodel.Sample{Metric: stream.Metric, Value: last.Value, Timestamp: last.Timestamp})
+		}
+	default:
+		return output, fmt.Errorf("unexpected result type %T for query '%s'", response, request)
 	}
 
-	highest := float64(0.00)
+	values := make(map[string][]float64)
 	for _, item := range sampleArray {
 		containerName := ""
 		for k, v := range item.Metric {
@@ -75,36 +171,256 @@ func queryStatistic(ctx context.Context, client *promClient, request string, now
 				containerName = string(v)
 			}
 		}
-		if float64(item.Value) > highest {
-			output[containerName] = float64(item.Value)
-			highest = float64(item.Value)
-		}
+		values[containerName] = append(values[containerName], float64(item.Value))
 	}
 
+	for container, v := range values {
+		output[container] = aggregate(v)
+	}
 	return output, nil
 }
 
+// queryRangeSamples returns the samples of a range query per container, the series of all pods are merged
+func queryRangeSamples(ctx context.Context, client *promClient, request string, r promv1.Range) (map[string][]prommodel.SamplePair, error) {
+	samples := make(map[string][]prommodel.SamplePair)
+	response, _, err := queryRangePrometheus(ctx, client, request, r)
+	if err != nil {
+		return samples, fmt.Errorf("Error querying range statistic %v", err)
+	}
+	asStreams, ok := response.(prommodel.Matrix)
+	if !ok {
+		return samples, fmt.Errorf("unexpected result type %T for range query '%s'", response, request)
+	}
+
+	for _, stream := range asStreams {
+		// a container without samples must not look like one with zero usage
+		if len(stream.Values) == 0 {
+			continue
+		}
+		containerName := string(stream.Metric["container"])
+		samples[containerName] = append(samples[containerName], stream.Values...)
+	}
+	return samples, nil
+}
+
+func sampleValues(samples []prommodel.SamplePair) []float64 {
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, float64(sample.Value))
+	}
+	return values
+}
+
+// samplePeak returns the highest sample and the time it was observed at
+func samplePeak(samples []prommodel.SamplePair) (float64, time.Time) {
+	highest := prommodel.SamplePair{}
+	for _, sample := range samples {
+		if sample.Value > highest.Value {
+			highest = sample
+		}
+	}
+	return float64(highest.Value), highest.Timestamp.Time()
+}
+
+// usageRange returns the usage series of the selector over the window as a range vector.
+// Custom templates may be any expression, for example a rate of a counter, so they are turned into a subquery.
+func usageRange(template string, defaultTemplate string, selector string, window string) string {
+	series := fmt.Sprintf(template, selector)
+	if template == defaultTemplate {
+		return fmt.Sprintf("%s[%s]", series, window)
+	}
+	return fmt.Sprintf("(%s)[%s:]", series, window)
+}
+
+func (o *Options) cpuRange(selector string, window string) string {
+	return usageRange(o.CPUMetric, cpuUsageSeries, selector, window)
+}
+
+func (o *Options) memoryRange(selector string, window string) string {
+	return usageRange(o.MemMetric, memoryUsageSeries, selector, window)
+}
+
+// overTime aggregates the usage over the window, the quantile aggregation uses --quantile and falls back to the average without it
+func (o *Options) overTime(aggregation string, usage string) string {
+	switch {
+	case aggregation == aggregationMax:
+		return fmt.Sprintf(usageMax, usage)
+	case aggregation == aggregationQuantile && o.Quantile != "":
+		return fmt.Sprintf(usageQuantile, o.Quantile, usage)
+	}
+	return fmt.Sprintf(usageAverage, usage)
+}
+
+func (o *Options) cpuRequestQuery(selector string, window string) string {
+	if o.RequestStrategy == requestStrategyPeakHour {
+		return fmt.Sprintf(podCPURequestPeakHour, o.cpuRange(selector, "1h"), window)
+	}
+	return o.overTime(o.RequestAggregation, o.cpuRange(selector, window))
+}
+
+func (o *Options) memoryRequestQuery(selector string, window string) string {
+	if o.RequestStrategy == requestStrategyPeakHour {
+		return fmt.Sprintf(podMemoryRequestPeakHour, o.memoryRange(selector, "1h"), window)
+	}
+	return fmt.Sprintf(podMemoryRequest, o.overTime(o.RequestAggregation, o.memoryRange(selector, window)))
+}
+
+// queryRequests queries the request suggestions over the window. With --recent-window the suggestions of the recent
+// and the history window are blended with --recent-weight, a container seen in only one of them uses that one.
+func (o *Options) queryRequests(ctx context.Context, client *promClient, query func(selector string, window string) string, selector string, now time.Time) (map[string]float64, error) {
+	if o.RecentWindow == "" {
+		return queryStatisticBy(ctx, client, query(selector, o.Window), now, o.aggregatePods)
+	}
+
+	history, err := queryStatisticBy(ctx, client, query(selector, o.HistoryWindow), now, o.aggregatePods)
+	if err != nil {
+		return history, err
+	}
+	recent, err := queryStatisticBy(ctx, client, query(selector, o.RecentWindow), now, o.aggregatePods)
+	if err != nil {
+		return recent, err
+	}
+	for container, value := range recent {
+		if old, ok := history[container]; ok {
+			value = o.RecentWeight*value + (1-o.RecentWeight)*old
+		}
+		history[container] = value
+	}
+	return history, nil
+}
+
+// limitMultiplier formats the limit margin as multiplier, e.g. 0.2 becomes 1.2
+func (o *Options) limitMultiplier() string {
+	return strconv.FormatFloat(1+o.LimitMargin, 'f', -1, 64)
+}
+
+func (o *Options) cpuLimitQuery(selector string) string {
+	return fmt.Sprintf(podCPULimit, o.overTime(o.LimitAggregation, o.cpuRange(selector, o.Window)), o.limitMultiplier())
+}
+
+func (o *Options) memoryLimitQuery(selector string) string {
+	return fmt.Sprintf(podMemoryLimit, o.overTime(o.LimitAggregation, o.memoryRange(selector, o.Window)), o.limitMultiplier())
+}
+
+// queryPrometheusForPod queries the usage of the pod, the containers in CrashLoopBackOff are known from its status
 func (o *Options) queryPrometheusForPod(ctx context.Context, client *promClient, pod v1.Pod) (prometheusMetrics, error) {
-	now := time.Now()
+	var output prometheusMetrics
+	var err error
+	if o.Backend == backendMetricsServer {
+		output, err = o.metricsServerUsage(ctx, pod.Namespace, regexp.QuoteMeta(pod.Name))
+	} else {
+		output, err = o.queryPrometheusForSelector(ctx, client, fmt.Sprintf(`namespace="%s", pod="%s"`, pod.Namespace, pod.Name))
+	}
+	if err != nil {
+		return output, err
+	}
+	if output.CrashLooping == nil {
+		output.CrashLooping = make(map[string]float64)
+	}
+	for _, status := range append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+			output.CrashLooping[status.Name] = 1
+		}
+	}
+	return output, nil
+}
+
+// queryPrometheusForSelector queries the usage of the series matching the label selector, e.g. pod="foo"
+func (o *Options) queryPrometheusForSelector(ctx context.Context, client *promClient, selector string) (prometheusMetrics, error) {
+	// the registered aggregators need the raw samples of the window
+	if !o.since.IsZero() || o.customAggregation() {
+		output, err := o.queryRangeForSelector(ctx, client, selector)
+		if err != nil {
+			return output, err
+		}
+		output.OOMKills, err = queryStatistic(ctx, client, o.oomQuery(selector), o.queryTime())
+		if err != nil {
+			return output, err
+		}
+		output.CrashLooping, err = queryStatistic(ctx, client, fmt.Sprintf(podCrashLooping, selector), o.queryTime())
+		if err != nil {
+			return output, err
+		}
+		if o.ThrottleThreshold > 0 {
+			output.Throttled, err = queryStatistic(ctx, client, o.throttleQuery(selector), o.queryTime())
+			if err != nil {
+				return output, err
+			}
+		}
+		if o.GPUMetric == "" {
+			return output, nil
+		}
+		output.GPUUsage, err = queryStatistic(ctx, client, o.gpuQuery(selector), o.queryTime())
+		return output, err
+	}
+
+	now := o.queryTime()
 	var err error
 
 	output := prometheusMetrics{}
-	output.RequestCPU, err = queryStatistic(ctx, client, fmt.Sprintf(podCPURequest, o.Quantile, pod.Name), now)
+	output.RequestCPU, err = o.queryRequests(ctx, client, o.cpuRequestQuery, selector, now)
 	if err != nil {
 		return output, err
 	}
 
-	output.LimitCPU, err = queryStatistic(ctx, client, fmt.Sprintf(podCPULimit, pod.Name, o.LimitMargin), now)
+	output.RequestMem, err = o.queryRequests(ctx, client, o.memoryRequestQuery, selector, now)
 	if err != nil {
 		return output, err
 	}
 
-	output.RequestMem, err = queryStatistic(ctx, client, fmt.Sprintf(podMemoryRequest, o.Quantile, pod.Name), now)
+	output.OOMKills, err = queryStatistic(ctx, client, o.oomQuery(selector), now)
 	if err != nil {
 		return output, err
 	}
 
-	output.LimitMem, err = queryStatistic(ctx, client, fmt.Sprintf(podMemoryLimit, pod.Name, o.LimitMargin), now)
+	output.CrashLooping, err = queryStatistic(ctx, client, fmt.Sprintf(podCrashLooping, selector), now)
+	if err != nil {
+		return output, err
+	}
+
+	if o.ThrottleThreshold > 0 {
+		output.Throttled, err = queryStatistic(ctx, client, o.throttleQuery(selector), now)
+		if err != nil {
+			return output, err
+		}
+	}
+
+	if o.GPUMetric != "" {
+		output.GPUUsage, err = queryStatistic(ctx, client, o.gpuQuery(selector), now)
+		if err != nil {
+			return output, err
+		}
+	}
+
+	if o.MinSamples > 0 {
+		output.Samples, err = queryStatistic(ctx, client, fmt.Sprintf(podSampleCount, o.cpuRange(selector, o.Window)), now)
+		if err != nil {
+			return output, err
+		}
+	}
+
+	if o.Output == outputVPA {
+		output.MinCPU, err = queryStatisticBy(ctx, client, fmt.Sprintf(usageMin, o.cpuRange(selector, o.Window)), now, float64Min)
+		if err != nil {
+			return output, err
+		}
+		output.MinMem, err = queryStatisticBy(ctx, client, fmt.Sprintf(podMemoryRequest, fmt.Sprintf(usageMin, o.memoryRange(selector, o.Window))), now, float64Min)
+		if err != nil {
+			return output, err
+		}
+	}
+
+	if o.Peak {
+		r := promv1.Range{Start: now.Add(-o.window), End: now, Step: rangeStep(now.Add(-o.window), now)}
+		return o.queryPeaks(ctx, client, selector, r, output)
+	}
+
+	output.LimitCPU, err = queryStatistic(ctx, client, o.cpuLimitQuery(selector), now)
+	if err != nil {
+		return output, err
+	}
+
+	output.LimitMem, err = queryStatistic(ctx, client, o.memoryLimitQuery(selector), now)
 	if err != nil {
 		return output, err
 	}
@@ -112,7 +428,217 @@ func (o *Options) queryPrometheusForPod(ctx context.Context, client *promClient,
 	return output, nil
 }
 
+// historyWindow returns the window or the length of the time range
+func (o *Options) historyWindow() string {
+	if !o.since.IsZero() {
+		return prommodel.Duration(o.until.Sub(o.since)).String()
+	}
+	return o.Window
+}
+
+// oomQuery returns the query telling which containers were OOM killed during the window or the time range
+func (o *Options) oomQuery(selector string) string {
+	return fmt.Sprintf(podOOMKilled, selector, o.historyWindow())
+}
+
+// throttleQuery returns the query for the share of the cfs periods in which the containers were cpu throttled
+func (o *Options) throttleQuery(selector string) string {
+	window := o.historyWindow()
+	return fmt.Sprintf(podCPUThrottled, selector, window, selector, window)
+}
+
+// gpuQuery returns the query for the highest gpu utilization of the containers during the window or the time range
+func (o *Options) gpuQuery(selector string) string {
+	return fmt.Sprintf(podGPUUsage, fmt.Sprintf(o.GPUMetric, selector), o.historyWindow())
+}
+
+// queryRangeForSelector computes the usage from the raw series between --since and --until
+func (o *Options) queryRangeForSelector(ctx context.Context, client *promClient, selector string) (prometheusMetrics, error) {
+	start, end := o.since, o.until
+	if start.IsZero() {
+		end = o.queryTime()
+		start = end.Add(-o.window)
+	}
+	r := promv1.Range{Start: start, End: end, Step: rangeStep(start, end)}
+	cpu, err := queryRangeSamples(ctx, client, fmt.Sprintf(o.CPUMetric, selector), r)
+	if err != nil {
+		return prometheusMetrics{}, err
+	}
+	mem, err := queryRangeSamples(ctx, client, fmt.Sprintf(o.MemMetric, selector), r)
+	if err != nil {
+		return prometheusMetrics{}, err
+	}
+
+	output := newPrometheusMetrics()
+	multiplier := 1 + o.LimitMargin
+	for container, samples := range cpu {
+		output.RequestCPU[container] = o.statistic(o.RequestAggregation, sampleValues(samples))
+		output.LimitCPU[container] = o.statistic(o.LimitAggregation, sampleValues(samples)) * multiplier
+		output.Samples[container] = float64(len(samples))
+	}
+	for container, samples := range mem {
+		output.RequestMem[container] = o.statistic(o.RequestAggregation, sampleValues(samples)) / 1024 / 1024
+		output.LimitMem[container] = o.statistic(o.LimitAggregation, sampleValues(samples)) / 1024 / 1024 * multiplier
+	}
+	if o.Output == outputVPA {
+		for container, samples := range cpu {
+			output.MinCPU[container] = float64Min(sampleValues(samples))
+		}
+		for container, samples := range mem {
+			output.MinMem[container] = float64Min(sampleValues(samples)) / 1024 / 1024
+		}
+	}
+	if o.LimitAggregation == aggregationMax {
+		o.setPeaks(output, cpu, mem)
+	}
+	return output, nil
+}
+
+// queryPeaks sets the limits from the highest usage observed in the range and records when it happened.
+// Each point of the range is the max_over_time of the raw samples since the previous point, the peak is not
+// missed between the steps and its time is known to a step.
+func (o *Options) queryPeaks(ctx context.Context, client *promClient, selector string, r promv1.Range, output prometheusMetrics) (prometheusMetrics, error) {
+	step := prommodel.Duration(r.Step).String()
+	cpu, err := queryRangeSamples(ctx, client, fmt.Sprintf(usageMax, o.cpuRange(selector, step)), r)
+	if err != nil {
+		return output, err
+	}
+	mem, err := queryRangeSamples(ctx, client, fmt.Sprintf(usageMax, o.memoryRange(selector, step)), r)
+	if err != nil {
+		return output, err
+	}
+	output.LimitCPU = make(map[string]float64)
+	output.LimitMem = make(map[string]float64)
+	output.CPUPeakAt = make(map[string]time.Time)
+	output.MemPeakAt = make(map[string]time.Time)
+	o.setPeaks(output, cpu, mem)
+	return output, nil
+}
+
+// setPeaks sets the limits to the peak usage with the limit margin and records when the peaks happened
+func (o *Options) setPeaks(output prometheusMetrics, cpu map[string][]prommodel.SamplePair, mem map[string][]prommodel.SamplePair) {
+	multiplier := 1 + o.LimitMargin
+	for container, samples := range cpu {
+		peak, at := samplePeak(samples)
+		output.LimitCPU[container] = peak * multiplier
+		output.CPUPeakAt[container] = at
+	}
+	for container, samples := range mem {
+		peak, at := samplePeak(samples)
+		output.LimitMem[container] = peak / 1024 / 1024 * multiplier
+		output.MemPeakAt[container] = at
+	}
+}
+
+// statistic aggregates the values like overTime does in prometheus, or with the registered aggregator
+func (o *Options) statistic(aggregation string, values []float64) float64 {
+	aggregator, _ := o.aggregator(aggregation)
+	return aggregator.Aggregate(values)
+}
+
+// rangeStep keeps range queries below the limit of 11000 points per series in prometheus
+func rangeStep(start time.Time, end time.Time) time.Duration {
+	step := (end.Sub(start) / 10000).Truncate(time.Second) + time.Second
+	if step < time.Minute {
+		return time.Minute
+	}
+	return step
+}
+
+// queryTime returns the time the instant queries are evaluated at
+func (o *Options) queryTime() time.Time {
+	if !o.until.IsZero() {
+		return o.until
+	}
+	if !o.at.IsZero() {
+		return o.at
+	}
+	return time.Now()
+}
+
+// checkPrometheus makes sure that prometheus answers to queries before any workload is analyzed
+func (o *Options) checkPrometheus(ctx context.Context) error {
+	if o.promClient.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.promClient.timeout)
+		defer cancel()
+	}
+
+	// the cache is bypassed, a cached answer does not tell if prometheus is reachable
+	promcli := promv1.NewAPI(o.promClient)
+	response, _, err := promcli.Query(ctx, preflightQuery, time.Now())
+	if err != nil {
+		return fmt.Errorf("cannot reach Prometheus at %s: %v", o.promClient.URL("", nil), err)
+	}
+	if _, ok := response.(prommodel.Vector); !ok {
+		return fmt.Errorf("cannot reach Prometheus at %s: unexpected response %T to query '%s'", o.promClient.URL("", nil), response, preflightQuery)
+	}
+	return nil
+}
+
+// checkRequiredMetrics makes sure that the metrics used by the queries exist in prometheus
+func (o *Options) checkRequiredMetrics(ctx context.Context) error {
+	for _, template := range []string{o.CPUMetric, o.MemMetric} {
+		metric := fmt.Sprintf(template, `namespace!=""`)
+		response, _, err := queryPrometheus(ctx, o.promClient, fmt.Sprintf(metricPresence, metric), time.Now())
+		if err != nil {
+			return fmt.Errorf("Error querying metric %s %v", metric, err)
+		}
+		samples, ok := response.(prommodel.Vector)
+		if !ok || len(samples) == 0 {
+			return fmt.Errorf("required metric '%s' returned no data from prometheus", metric)
+		}
+	}
+	return nil
+}
+
+// apply replaces the usage of the containers that exist in the reference profile
+func (p prometheusMetrics) apply(target prometheusMetrics) prometheusMetrics {
+	target.merge(p)
+	return target
+}
+
+// floatMaps returns every per-container value map of the metrics, the copies and aggregations go over all of them
+// so that no field is left behind
+func (p prometheusMetrics) floatMaps() []map[string]float64 {
+	return []map[string]float64{
+		p.LimitCPU, p.LimitMem, p.RequestCPU, p.RequestMem, p.Samples,
+		p.OOMKills, p.Throttled, p.GPUUsage, p.CrashLooping, p.MinCPU, p.MinMem,
+	}
+}
+
+// timeMaps returns the per-container peak times of the metrics
+func (p prometheusMetrics) timeMaps() []map[string]time.Time {
+	return []map[string]time.Time{p.CPUPeakAt, p.MemPeakAt}
+}
+
+// merge sets every value of the containers in other, p must have its maps made
+func (p prometheusMetrics) merge(other prometheusMetrics) {
+	others := other.floatMaps()
+	for i, values := range p.floatMaps() {
+		for k, v := range others[i] {
+			values[k] = v
+		}
+	}
+	otherTimes := other.timeMaps()
+	for i, times := range p.timeMaps() {
+		for k, v := range otherTimes[i] {
+			times[k] = v
+		}
+	}
+}
+
+// copy returns the metrics with new maps, changing them does not change p
+func (p prometheusMetrics) copy() prometheusMetrics {
+	output := newPrometheusMetrics()
+	output.merge(p)
+	return output
+}
+
 func float64Average(input []float64) float64 {
+	if len(input) == 0 {
+		return 0
+	}
 	var sum float64
 	for _, value := range input {
 		sum += value
@@ -120,6 +646,36 @@ func float64Average(input []float64) float64 {
 	return sum / float64(len(input))
 }
 
+// float64Percentile returns the q-quantile (0 <= q <= 1) of the input using linear interpolation
+func float64Percentile(input []float64, q float64) float64 {
+	if len(input) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(input))
+	copy(sorted, input)
+	sort.Float64s(sorted)
+
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// float64Min returns the lowest value, the usage of a container is never negative
+func float64Min(input []float64) float64 {
+	lowest := math.Inf(1)
+	for _, value := range input {
+		lowest = math.Min(lowest, value)
+	}
+	if math.IsInf(lowest, 1) {
+		return 0
+	}
+	return lowest
+}
+
 func float64Peak(input []float64) float64 {
 	highest := float64(0.00)
 	for _, value := range input {
@@ -130,38 +686,74 @@ func float64Peak(input []float64) float64 {
 	return highest
 }
 
+// aggregatePods combines the request suggestions of the pods of a workload as set by --pod-aggregation
+func (o *Options) aggregatePods(values []float64) float64 {
+	switch o.PodAggregation {
+	case podAggregationAvg:
+		return float64Average(values)
+	case podAggregationP95:
+		return float64Percentile(values, 0.95)
+	}
+	return float64Peak(values)
+}
+
+// findReplicaset returns the replicaset of the current deployment revision.
+// The revisions are counted per deployment, so replicasets of other deployments matching the selector are skipped.
+// Should several replicasets claim the revision, the newest one is used.
 func findReplicaset(replicasets *appsv1.ReplicaSetList, dep appsv1.Deployment) (*appsv1.ReplicaSet, error) {
 	generation, ok := dep.Annotations[deploymentRevision]
 	if !ok {
 		return nil, fmt.Errorf("could not find label %s for deployment '%s'", deploymentRevision, dep.Name)
 	}
-	for _, replicaset := range replicasets.Items {
+	var current *appsv1.ReplicaSet
+	for i := range replicasets.Items {
+		replicaset := &replicasets.Items[i]
+		if !metav1.IsControlledBy(replicaset, &dep) {
+			continue
+		}
 		val, ok := replicaset.Annotations[deploymentRevision]
-		if ok && val == generation {
-			return &replicaset, nil
+		if !ok || val != generation {
+			continue
+		}
+		if current == nil || current.CreationTimestamp.Before(&replicaset.CreationTimestamp) {
+			current = replicaset
 		}
 	}
-	return nil, fmt.Errorf("could not find replicaset for deployment '%s' gen '%v'", dep.Name, generation)
+	if current == nil {
+		return nil, fmt.Errorf("could not find replicaset for deployment '%s' gen '%v'", dep.Name, generation)
+	}
+	return current, nil
+}
+
+// replicasetPodRegex matches the pods of the replicaset, the pod name is the replicaset name and a random suffix
+func replicasetPodRegex(replicaset appsv1.ReplicaSet) string {
+	return fmt.Sprintf("%s-%s", regexp.QuoteMeta(replicaset.Name), generatedSuffix)
 }
 
-func makePrometheusClientForCluster() (*promClient, error) {
-	config, _, err := findConfig()
+// makePrometheusClientForCluster talks to the given prometheus url directly or
+// to the prometheus operator service through the kubernetes api proxy when the url is empty
+func (o *Options) makePrometheusClientForCluster(prometheusURL string) (*promClient, error) {
+	if prometheusURL != "" {
+		return makePrometheusClientForURL(prometheusURL)
+	}
+
+	config, _, err := o.findConfig()
 	if err != nil {
 		return nil, err
 	}
 
 	promurl := fmt.Sprintf("%s%s", config.Host, promOperatorClusterURL)
+	if !hasCredentials(config) {
+		return nil, fmt.Errorf("kubeconfig for '%s' does not contain client certificates or token, cannot proxy to prometheus", config.Host)
+	}
 	transport, err := rest.TransportFor(config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not build transport for '%s': %v", config.Host, err)
 	}
 
-	var httpClient *http.Client
-	if transport != http.DefaultTransport {
-		httpClient = &http.Client{Transport: transport}
-		if config.Timeout > 0 {
-			httpClient.Timeout = config.Timeout
-		}
+	httpClient := &http.Client{Transport: transport}
+	if config.Timeout > 0 {
+		httpClient.Timeout = config.Timeout
 	}
 
 	u, err := url.Parse(promurl)
@@ -174,24 +766,145 @@ func makePrometheusClientForCluster() (*promClient, error) {
 		endpoint: u,
 		client:   httpClient,
 	}, nil
-	return nil, nil
+}
+
+func makePrometheusClientForURL(prometheusURL string) (*promClient, error) {
+	u, err := url.Parse(prometheusURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse prometheus url '%s': %v", prometheusURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("prometheus url '%s' must start with http:// or https://", prometheusURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+
+	return &promClient{
+		endpoint: u,
+		client:   &http.Client{},
+	}, nil
+}
+
+// hasCredentials tells if the rest config can authenticate with either client certificates or a token
+func hasCredentials(config *rest.Config) bool {
+	tls := config.TLSClientConfig
+	if (len(tls.CertData) > 0 || tls.CertFile != "") && (len(tls.KeyData) > 0 || tls.KeyFile != "") {
+		return true
+	}
+	return config.BearerToken != "" || config.BearerTokenFile != "" || config.ExecProvider != nil ||
+		config.AuthProvider != nil || config.Username != ""
 }
 
 func queryPrometheus(ctx context.Context, client *promClient, query string, ts time.Time) (interface{}, promv1.Warnings, error) {
+	if client.cache != nil {
+		value, ok := client.cache.get(query, ts)
+		if ok {
+			glog.V(4).Infof("cached query %s returned %d series", query, resultSize(value))
+			return value, nil, nil
+		}
+	}
+
+	if client.limiter != nil {
+		err := client.limiter.Wait(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the timeout starts when the query is sent, not while waiting for the limiter
+	if client.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.timeout)
+		defer cancel()
+	}
+
+	promcli := promv1.NewAPI(client)
+	value, warnings, err := promcli.Query(ctx, query, ts)
+	if err != nil {
+		return value, warnings, err
+	}
+	glog.V(4).Infof("query %s at %s returned %d series", query, ts.Format(time.RFC3339), resultSize(value))
+
+	if client.cache != nil {
+		err = client.cache.set(query, ts, value)
+		if err != nil {
+			glog.Warningf("could not cache query %s: %v", query, err)
+		}
+	}
+	return value, warnings, nil
+}
+
+func queryRangePrometheus(ctx context.Context, client *promClient, query string, r promv1.Range) (interface{}, promv1.Warnings, error) {
+	// the start is relative to now for a window, the length of the range keeps the key stable within the cache ttl
+	key := fmt.Sprintf("%s range=%s step=%s", query, r.End.Sub(r.Start), r.Step)
+	if client.cache != nil {
+		value, ok := client.cache.get(key, r.End)
+		if ok {
+			glog.V(4).Infof("cached range query %s returned %d series", key, resultSize(value))
+			return value, nil, nil
+		}
+	}
+
+	if client.limiter != nil {
+		err := client.limiter.Wait(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if client.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.timeout)
+		defer cancel()
+	}
+
 	promcli := promv1.NewAPI(client)
-	return promcli.Query(ctx, query, ts)
+	value, warnings, err := promcli.QueryRange(ctx, query, r)
+	if err != nil {
+		return value, warnings, err
+	}
+	glog.V(4).Infof("range query %s returned %d series", key, resultSize(value))
+
+	if client.cache != nil {
+		err = client.cache.set(key, r.End, value)
+		if err != nil {
+			glog.Warningf("could not cache query %s: %v", query, err)
+		}
+	}
+	return value, warnings, nil
 }
 
-func (c *promClient) URL(ep string, args map[string]string) *url.URL {
-	p := path.Join(c.endpoint.Path, ep)
+// resultSize returns the amount of series in the query result
+func resultSize(value prommodel.Value) int {
+	switch result := value.(type) {
+	case prommodel.Vector:
+		return len(result)
+	case prommodel.Matrix:
+		return len(result)
+	}
+	return 1
+}
 
+// URL appends the api endpoint to the path of the prometheus url. The path prefix of a reverse proxy is kept as is,
+// including its escaping, and only the endpoint gets the arguments, e.g. :name of the label values.
+func (c *promClient) URL(ep string, args map[string]string) *url.URL {
 	for arg, val := range args {
 		arg = ":" + arg
-		p = strings.Replace(p, arg, val, -1)
+		ep = strings.Replace(ep, arg, val, -1)
 	}
+	ep = strings.TrimLeft(ep, "/")
 
 	u := *c.endpoint
-	u.Path = p
+	u.Path = strings.TrimRight(c.endpoint.Path, "/") + "/" + ep
+	if c.endpoint.RawPath != "" {
+		u.RawPath = strings.TrimRight(c.endpoint.RawPath, "/") + "/" + ep
+	}
+	if len(c.params) > 0 {
+		query := c.endpoint.Query()
+		for key, values := range c.params {
+			query[key] = values
+		}
+		u.RawQuery = query.Encode()
+	}
 
 	return &u
 }
@@ -200,6 +913,11 @@ func (c *promClient) Do(ctx context.Context, req *http.Request) (*http.Response,
 	if ctx != nil {
 		req = req.WithContext(ctx)
 	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
 	resp, err := c.client.Do(req)
 	defer func() {
 		if resp != nil {
@@ -245,60 +963,225 @@ func ByteCountSI(b int64) string {
 		float64(b)/float64(div), "kMGTPE"[exp])
 }
 
-func (o *Options) findPods(ctx context.Context, namespace string, selector string) (prometheusMetrics, error) {
-	final := prometheusMetrics{
-		LimitCPU:   make(map[string]float64),
-		LimitMem:   make(map[string]float64),
-		RequestCPU: make(map[string]float64),
-		RequestMem: make(map[string]float64),
+// ByteCountIEC formats the bytes in binary units like the kubernetes quantities, e.g. 1.5 GiB
+func ByteCountIEC(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB",
+		float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// byteCount formats the bytes in the units chosen with --byte-units
+func (o *Options) byteCount(b int64) string {
+	if o.ByteUnits == byteUnitsSI {
+		return ByteCountSI(b)
 	}
+	return ByteCountIEC(b)
+}
 
-	pods, err := o.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+// findPods queries the usage of the pods of the owner matching the selector. With a revision only the pods of
+// that controller revision are used, so that the usage of the pods of an older revision does not leak in.
+func (o *Options) findPods(ctx context.Context, owner metav1.Object, selector string, revision string) (prometheusMetrics, error) {
+	list, err := o.client.CoreV1().Pods(owner.GetNamespace()).List(ctx, metav1.ListOptions{
 		LabelSelector: selector,
 	})
 	if err != nil {
-		return final, err
+		return newPrometheusMetrics(), err
 	}
+	pods := currentPods(list.Items, owner, revision)
+	glog.V(2).Infof("selector %s matched %d pods in namespace %s, %d of them are current pods of %s", selector, len(list.Items), owner.GetNamespace(), len(pods), owner.GetName())
 
-	totalLimitCPU := make(map[string][]float64)
-	totalLimitMem := make(map[string][]float64)
-	totalRequestCPU := make(map[string][]float64)
-	totalRequestMem := make(map[string][]float64)
+	// every pod does its own queries, run them with a bounded amount of workers
+	outputs := make([]prometheusMetrics, len(pods))
+	errs := make([]error, len(pods))
+	workers := make(chan struct{}, o.Concurrency)
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			outputs[i], errs[i] = o.queryPrometheusForPod(ctx, o.promClient, pods[i])
+		}(i)
+	}
+	wg.Wait()
 
-	for _, pod := range pods.Items {
-		output, err := o.queryPrometheusForPod(ctx, o.promClient, pod)
+	for _, err := range errs {
 		if err != nil {
-			return final, err
+			return newPrometheusMetrics(), err
 		}
-		for k, v := range output.RequestCPU {
-			totalRequestCPU[k] = append(totalRequestCPU[k], v)
+	}
+	return o.aggregateMetrics(outputs), nil
+}
+
+// currentPods keeps the pods controlled by the owner, selectors of different workloads may overlap.
+// When the pods of the revision are not running yet, e.g. a paused rollout, the pods of the owner are used as is.
+func currentPods(pods []v1.Pod, owner metav1.Object, revision string) []v1.Pod {
+	owned := []v1.Pod{}
+	for _, pod := range pods {
+		if metav1.IsControlledBy(&pod, owner) {
+			owned = append(owned, pod)
+		}
+	}
+	if revision == "" {
+		return owned
+	}
+	current := []v1.Pod{}
+	for _, pod := range owned {
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] == revision {
+			current = append(current, pod)
+		}
+	}
+	if len(current) == 0 {
+		return owned
+	}
+	return current
+}
+
+// podNameMetrics finds the historical usage of a deployment by the pod name prefix, also when it has no pods
+func (o *Options) podNameMetrics(ctx context.Context, deployment appsv1.Deployment) (prometheusMetrics, error) {
+	output, err := o.podUsage(ctx, deployment.Namespace, deploymentPodRegex(deployment))
+	if err != nil {
+		return newPrometheusMetrics(), err
+	}
+	return o.aggregateMetrics([]prometheusMetrics{output}), nil
+}
+
+func newPrometheusMetrics() prometheusMetrics {
+	return prometheusMetrics{
+		LimitCPU:     make(map[string]float64),
+		LimitMem:     make(map[string]float64),
+		RequestCPU:   make(map[string]float64),
+		RequestMem:   make(map[string]float64),
+		Samples:      make(map[string]float64),
+		CPUPeakAt:    make(map[string]time.Time),
+		MemPeakAt:    make(map[string]time.Time),
+		OOMKills:     make(map[string]float64),
+		Throttled:    make(map[string]float64),
+		GPUUsage:     make(map[string]float64),
+		CrashLooping: make(map[string]float64),
+		MinCPU:       make(map[string]float64),
+		MinMem:       make(map[string]float64),
+	}
+}
+
+// aggregateMetrics combines the requests of each container over the outputs as set by --pod-aggregation,
+// takes the peak of the rest and rounds them
+func (o *Options) aggregateMetrics(outputs []prometheusMetrics) prometheusMetrics {
+	final := newPrometheusMetrics()
+
+	// how the values of the pods are combined, in the order of floatMaps
+	aggregates := []func([]float64) float64{
+		func(values []float64) float64 { return o.roundCPU(float64Peak(values)) },
+		func(values []float64) float64 { return o.roundMem(float64Peak(values)) },
+		func(values []float64) float64 { return o.roundCPU(o.aggregatePods(values)) },
+		func(values []float64) float64 { return o.roundMem(o.aggregatePods(values)) },
+		float64Peak,
+		float64Peak,
+		float64Peak,
+		float64Peak,
+		float64Peak,
+		float64Min,
+		float64Min,
+	}
+	totals := make([]map[string][]float64, len(aggregates))
+	for i := range totals {
+		totals[i] = make(map[string][]float64)
+	}
+	for _, output := range outputs {
+		for i, values := range output.floatMaps() {
+			for k, v := range values {
+				totals[i][k] = append(totals[i][k], v)
+			}
 		}
-		for k, v := range output.RequestMem {
-			totalRequestMem[k] = append(totalRequestMem[k], v)
+	}
+	for i, values := range final.floatMaps() {
+		for k, v := range totals[i] {
+			values[k] = aggregates[i](v)
 		}
-		for k, v := range output.LimitCPU {
-			totalLimitCPU[k] = append(totalLimitCPU[k], v)
+	}
+
+	// the peak time is taken from the output having the highest peak
+	peakCPU := make(map[string]float64)
+	peakMem := make(map[string]float64)
+	for _, output := range outputs {
+		for k, v := range output.CPUPeakAt {
+			if _, ok := final.CPUPeakAt[k]; !ok || output.LimitCPU[k] > peakCPU[k] {
+				final.CPUPeakAt[k] = v
+				peakCPU[k] = output.LimitCPU[k]
+			}
 		}
-		for k, v := range output.LimitMem {
-			totalLimitMem[k] = append(totalLimitMem[k], v)
+		for k, v := range output.MemPeakAt {
+			if _, ok := final.MemPeakAt[k]; !ok || output.LimitMem[k] > peakMem[k] {
+				final.MemPeakAt[k] = v
+				peakMem[k] = output.LimitMem[k]
+			}
 		}
 	}
+	return final
+}
+
+// roundCPU rounds cores up to the next --cpu-round step, 0.1 core by default
+func (o *Options) roundCPU(value float64) float64 {
+	scale := 1000 / o.cpuRound
+	return math.Ceil(value*scale) / scale
+}
+
+// roundMem rounds MiB up to the next --mem-round step, 100Mi by default
+func (o *Options) roundMem(value float64) float64 {
+	return math.Ceil(value/o.memRound) * o.memRound
+}
+
+// applyFloors raises the cpu and memory suggestions below --cpu-floor and --mem-floor to the floor
+func (o *Options) applyFloors(p prometheusMetrics) prometheusMetrics {
+	if o.cpuFloor <= 0 && o.memFloor <= 0 {
+		return p
+	}
+	output := p
+	output.RequestCPU = floorValues(p.RequestCPU, o.cpuFloor)
+	output.LimitCPU = floorValues(p.LimitCPU, o.cpuFloor)
+	output.RequestMem = floorValues(p.RequestMem, o.memFloor)
+	output.LimitMem = floorValues(p.LimitMem, o.memFloor)
+	return output
+}
+
+// floorValues returns a copy of the values where nothing is below the floor
+func floorValues(values map[string]float64, floor float64) map[string]float64 {
+	output := make(map[string]float64, len(values))
+	for k, v := range values {
+		output[k] = math.Max(v, floor)
+	}
+	return output
+}
 
-	for k, v := range totalRequestCPU {
-		scale := 10
-		value := float64Peak(v)
-		final.RequestCPU[k] = math.Ceil(value*float64(scale)) / float64(scale)
+// scale multiplies all usage values and rounds them again
+func (o *Options) scale(p prometheusMetrics, multiplier float64) prometheusMetrics {
+	output := p.copy()
+	for k, v := range p.RequestCPU {
+		output.RequestCPU[k] = o.roundCPU(v * multiplier)
+	}
+	for k, v := range p.RequestMem {
+		output.RequestMem[k] = o.roundMem(v * multiplier)
+	}
+	for k, v := range p.LimitCPU {
+		output.LimitCPU[k] = o.roundCPU(v * multiplier)
 	}
-	for k, v := range totalRequestMem {
-		final.RequestMem[k] = math.Ceil(float64Peak(v)/100) * 100
+	for k, v := range p.LimitMem {
+		output.LimitMem[k] = o.roundMem(v * multiplier)
 	}
-	for k, v := range totalLimitCPU {
-		scale := 10
-		value := float64Peak(v)
-		final.LimitCPU[k] = math.Ceil(value*float64(scale)) / float64(scale)
+	for k, v := range p.MinCPU {
+		output.MinCPU[k] = v * multiplier
 	}
-	for k, v := range totalLimitMem {
-		final.LimitMem[k] = math.Ceil(float64Peak(v)/100) * 100
+	for k, v := range p.MinMem {
+		output.MinMem[k] = v * multiplier
 	}
-	return final, nil
+	return output
 }
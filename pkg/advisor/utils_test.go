@@ -0,0 +1,451 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func ownedPod(name string, owner metav1.Object, revision string) v1.Pod {
+	controller := true
+	return v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Labels:          map[string]string{appsv1.ControllerRevisionHashLabelKey: revision},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: owner.GetName(), UID: owner.GetUID(), Controller: &controller}},
+	}}
+}
+
+func podNames(pods []v1.Pod) []string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestCurrentPods(t *testing.T) {
+	web := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web-uid"}}
+	other := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "web-canary", UID: "canary-uid"}}
+	pods := []v1.Pod{
+		ownedPod("web-0", web, "web-new"),
+		ownedPod("web-1", web, "web-old"),
+		ownedPod("web-2", web, "web-new"),
+		ownedPod("web-canary-0", other, "web-new"),
+	}
+
+	tests := []struct {
+		name     string
+		revision string
+		want     []string
+	}{
+		{name: "old revision and other owner are dropped", revision: "web-new", want: []string{"web-0", "web-2"}},
+		{name: "no revision keeps the owned pods", revision: "", want: []string{"web-0", "web-1", "web-2"}},
+		{name: "no pod of the revision keeps the owned pods", revision: "web-next", want: []string{"web-0", "web-1", "web-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := podNames(currentPods(pods, web, tt.revision))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("currentPods() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakePrometheus answers every query with the given data of the prometheus api response
+func fakePrometheus(t *testing.T, data string) *promClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": "success", "data": %s}`, data)
+	}))
+	t.Cleanup(server.Close)
+	client, err := makePrometheusClientForURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestQueryStatisticBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "vector",
+			data: `{"resultType": "vector", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "value": [1600000000, "0.5"]},
+				{"metric": {"container": "app", "pod": "web-2"}, "value": [1600000000, "0.7"]},
+				{"metric": {"container": "sidecar", "pod": "web-1"}, "value": [1600000000, "0.1"]}]}`,
+			want: map[string]float64{"app": 0.7, "sidecar": 0.1},
+		},
+		{
+			name: "matrix uses the latest value",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": [[1600000000, "0.9"], [1600000060, "0.3"]]}]}`,
+			want: map[string]float64{"app": 0.3},
+		},
+		{
+			name:    "scalar",
+			data:    `{"resultType": "scalar", "result": [1600000000, "1"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "string",
+			data:    `{"resultType": "string", "result": [1600000000, "foo"]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryStatisticBy(context.Background(), fakePrometheus(t, tt.data), "up", time.Now(), float64Peak)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queryStatisticBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryStatisticBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromClientURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		params url.Values
+		ep     string
+		args   map[string]string
+		want   string
+	}{
+		{
+			name: "path prefix with trailing slash",
+			base: "https://host/prometheus/",
+			ep:   "/api/v1/query",
+			want: "https://host/prometheus/api/v1/query",
+		},
+		{
+			name: "no path prefix",
+			base: "https://host",
+			ep:   "/api/v1/query",
+			want: "https://host/api/v1/query",
+		},
+		{
+			name: "escaped path prefix is kept",
+			base: "https://host/team%2Fa/prometheus/",
+			ep:   "/api/v1/query",
+			want: "https://host/team%2Fa/prometheus/api/v1/query",
+		},
+		{
+			name:   "query of the url is merged with the thanos params",
+			base:   "https://host/thanos/?tenant=a",
+			params: url.Values{"dedup": []string{"true"}, "partial_response": []string{"false"}},
+			ep:     "/api/v1/query",
+			want:   "https://host/thanos/api/v1/query?dedup=true&partial_response=false&tenant=a",
+		},
+		{
+			name: "arguments are only replaced in the endpoint",
+			base: "https://host/:name/",
+			ep:   "/api/v1/label/:name/values",
+			args: map[string]string{"name": "namespace"},
+			want: "https://host/:name/api/v1/label/namespace/values",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := makePrometheusClientForURL(tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.params = tt.params
+			got := client.URL(tt.ep, tt.args).String()
+			if got != tt.want {
+				t.Errorf("URL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryStatisticByMatrix(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]float64
+	}{
+		{
+			name: "latest value of each series is aggregated per container",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": [[1600000000, "0.9"], [1600000060, "0.3"]]},
+				{"metric": {"container": "app", "pod": "web-2"}, "values": [[1600000000, "0.1"], [1600000060, "0.4"]]},
+				{"metric": {"container": "sidecar", "pod": "web-1"}, "values": [[1600000060, "0.05"]]}]}`,
+			want: map[string]float64{"app": 0.4, "sidecar": 0.05},
+		},
+		{
+			name: "empty streams are skipped",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": []},
+				{"metric": {"container": "sidecar", "pod": "web-1"}, "values": [[1600000060, "0.05"]]}]}`,
+			want: map[string]float64{"sidecar": 0.05},
+		},
+		{
+			name: "empty matrix",
+			data: `{"resultType": "matrix", "result": []}`,
+			want: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryStatisticBy(context.Background(), fakePrometheus(t, tt.data), "up", time.Now(), float64Peak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryStatisticBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryRangeSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string][]float64
+		wantErr bool
+	}{
+		{
+			name: "series of the pods are merged per container",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": [[1600000000, "1"], [1600000060, "2"]]},
+				{"metric": {"container": "app", "pod": "web-2"}, "values": [[1600000000, "3"]]},
+				{"metric": {"container": "sidecar", "pod": "web-1"}, "values": [[1600000000, "4"]]}]}`,
+			want: map[string][]float64{"app": {1, 2, 3}, "sidecar": {4}},
+		},
+		{
+			name: "empty streams add no samples",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": []},
+				{"metric": {"container": "app", "pod": "web-2"}, "values": [[1600000000, "3"]]}]}`,
+			want: map[string][]float64{"app": {3}},
+		},
+		{
+			name: "container with only empty streams is left out",
+			data: `{"resultType": "matrix", "result": [
+				{"metric": {"container": "app", "pod": "web-1"}, "values": []}]}`,
+			want: map[string][]float64{},
+		},
+		{
+			name:    "vector is not a range",
+			data:    `{"resultType": "vector", "result": []}`,
+			wantErr: true,
+		},
+	}
+	r := promv1.Range{Start: time.Unix(1600000000, 0), End: time.Unix(1600000060, 0), Step: time.Minute}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := queryRangeSamples(context.Background(), fakePrometheus(t, tt.data), "up", r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queryRangeSamples() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := map[string][]float64{}
+			for container, values := range samples {
+				got[container] = sampleValues(values)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryRangeSamples() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindReplicaset(t *testing.T) {
+	controller := true
+	deployment := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web-uid", Annotations: map[string]string{deploymentRevision: "3"}}}
+	other := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web-canary", UID: "canary-uid"}}
+	created := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	replicaset := func(name string, owner appsv1.Deployment, revision string, replicas int32, age time.Duration) appsv1.ReplicaSet {
+		return appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Annotations:       map[string]string{deploymentRevision: revision},
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+				OwnerReferences:   []metav1.OwnerReference{{Kind: "Deployment", Name: owner.Name, UID: owner.UID, Controller: &controller}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		replicasets []appsv1.ReplicaSet
+		want        string
+		wantErr     bool
+	}{
+		{
+			name: "newest revision among scaled to zero old ones",
+			replicasets: []appsv1.ReplicaSet{
+				replicaset("web-1", deployment, "1", 0, 72*time.Hour),
+				replicaset("web-3", deployment, "3", 2, time.Hour),
+				replicaset("web-2", deployment, "2", 0, 24*time.Hour),
+			},
+			want: "web-3",
+		},
+		{
+			name: "replicaset of another deployment with the same revision is skipped",
+			replicasets: []appsv1.ReplicaSet{
+				replicaset("web-canary-3", other, "3", 1, 0),
+				replicaset("web-3", deployment, "3", 2, time.Hour),
+			},
+			want: "web-3",
+		},
+		{
+			name: "tie on the revision picks the newest replicaset",
+			replicasets: []appsv1.ReplicaSet{
+				replicaset("web-3-old", deployment, "3", 0, 48*time.Hour),
+				replicaset("web-3-new", deployment, "3", 2, time.Hour),
+				replicaset("web-3-older", deployment, "3", 0, 96*time.Hour),
+			},
+			want: "web-3-new",
+		},
+		{
+			name: "no replicaset of the revision",
+			replicasets: []appsv1.ReplicaSet{
+				replicaset("web-1", deployment, "1", 0, 72*time.Hour),
+				replicaset("web-2", deployment, "2", 2, 24*time.Hour),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findReplicaset(&appsv1.ReplicaSetList{Items: tt.replicasets}, deployment)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findReplicaset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Name != tt.want {
+				t.Errorf("findReplicaset() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPeaks(t *testing.T) {
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Error(err)
+		}
+		queries = append(queries, r.Form.Get("query"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"container": "app"}, "values": [[1600000000, "1048576"], [1600000060, "4194304"], [1600000120, "2097152"]]}]}}`)
+	}))
+	t.Cleanup(server.Close)
+	client, err := makePrometheusClientForURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{CPUMetric: cpuUsageSeries, MemMetric: memoryUsageSeries, LimitMargin: 0.5}
+	r := promv1.Range{Start: time.Unix(1600000000, 0), End: time.Unix(1600000120, 0), Step: time.Minute}
+	output, err := o.queryPeaks(context.Background(), client, `namespace="shop"`, r, newPrometheusMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every step is the highest raw sample since the previous one, a spike between the steps is not missed
+	want := []string{
+		`max_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace="shop", container!=""}[1m])`,
+		`max_over_time(container_memory_working_set_bytes{namespace="shop", container!=""}[1m])`,
+	}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %q, want %q", queries, want)
+	}
+	if output.LimitMem["app"] != 6 || !output.MemPeakAt["app"].Equal(time.Unix(1600000060, 0)) {
+		t.Errorf("memory peak = %g at %s, want 6 at %s", output.LimitMem["app"], output.MemPeakAt["app"], time.Unix(1600000060, 0))
+	}
+}
+
+func TestQueryRangePrometheusCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"container": "app"}, "values": [[1600000000, "1"]]}]}}`)
+	}))
+	t.Cleanup(server.Close)
+	client, err := makePrometheusClientForURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.cache, err = newQueryCache(t.TempDir(), time.Hour, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a window ending a few seconds later starts later too, it is still the same query
+	end := time.Now().Truncate(time.Hour).Add(time.Minute)
+	for _, offset := range []time.Duration{0, 5 * time.Second} {
+		r := promv1.Range{Start: end.Add(offset - 24*time.Hour), End: end.Add(offset), Step: time.Minute}
+		_, _, err := queryRangePrometheus(context.Background(), client, "up", r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("prometheus got %d requests, want 1", requests)
+	}
+}
+
+func TestMetricsKeepEveryField(t *testing.T) {
+	full := newPrometheusMetrics()
+	if got, want := len(full.floatMaps())+len(full.timeMaps()), reflect.TypeOf(full).NumField(); got != want {
+		t.Fatalf("floatMaps and timeMaps have %d maps, prometheusMetrics has %d fields", got, want)
+	}
+	for _, values := range full.floatMaps() {
+		values["app"] = 2
+	}
+	for _, times := range full.timeMaps() {
+		times["app"] = time.Unix(1600000000, 0)
+	}
+
+	o := &Options{cpuRound: 100, memRound: 100}
+	outputs := map[string]prometheusMetrics{
+		"apply":       full.apply(newPrometheusMetrics()),
+		"scale":       o.scale(full, 1.5),
+		"hpaAdjusted": o.hpaAdjusted(full, 80),
+		"aggregate":   o.aggregateMetrics([]prometheusMetrics{full}),
+	}
+	for name, output := range outputs {
+		for i, values := range output.floatMaps() {
+			if _, ok := values["app"]; !ok {
+				t.Errorf("%s: value map %d lost the container", name, i)
+			}
+		}
+		for i, times := range output.timeMaps() {
+			if _, ok := times["app"]; !ok {
+				t.Errorf("%s: time map %d lost the container", name, i)
+			}
+		}
+	}
+	if full.RequestCPU["app"] != 2 {
+		t.Errorf("scale changed the input, RequestCPU = %v", full.RequestCPU["app"])
+	}
+}
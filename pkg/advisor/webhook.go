@@ -0,0 +1,95 @@
+package advisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds the post of the digest, a hanging webhook must not keep the run from exiting
+const webhookTimeout = 30 * time.Second
+
+// workloadSavings sums the savings of the recommendations per workload, in the order of the recommendations
+func workloadSavings(recommendations []Recommendation) ([]Workload, map[Workload]savings) {
+	order := []Workload{}
+	totals := make(map[Workload]savings)
+	for _, r := range recommendations {
+		if _, ok := totals[r.Workload]; !ok {
+			order = append(order, r.Workload)
+		}
+		totals[r.Workload] = totals[r.Workload].add(r.CPUSavings, r.MemSavings)
+	}
+	return order, totals
+}
+
+// webhookMessage formats the digest of the run in the mrkdwn of slack
+func (o *Options) webhookMessage() string {
+	workloads := 0
+	for _, count := range o.analyzed {
+		workloads += count
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "*resource-advisor* on %s: %d workloads analyzed, %d containers with suggestions\n", o.ClusterName, workloads, len(o.recommendations)+o.streamed)
+	fmt.Fprintf(&text, "Reclaimable: %.2f vCPUs and %s memory", o.totals.ReclaimCPU, o.byteCount(int64(o.totals.ReclaimMem)))
+	if o.totals.AddCPU > 0 || o.totals.AddMem > 0 {
+		fmt.Fprintf(&text, ", needed on top: %.2f vCPUs and %s memory", o.totals.AddCPU, o.byteCount(int64(o.totals.AddMem)))
+	}
+	text.WriteString("\n")
+
+	order, totals := workloadSavings(o.recommendations)
+	if o.stream != nil {
+		order, totals = append([]Workload{}, o.streamedWorkloads...), o.streamedSavings
+	}
+	score := func(w Workload) float64 {
+		return o.wasteScore(totals[w].ReclaimCPU, totals[w].ReclaimMem)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return score(order[i]) > score(order[j])
+	})
+	if len(order) > o.WebhookTop {
+		order = order[:o.WebhookTop]
+	}
+	if len(order) > 0 && score(order[0]) > 0 {
+		fmt.Fprintf(&text, "Top savings:\n")
+	}
+	for _, w := range order {
+		if score(w) <= 0 {
+			break
+		}
+		fmt.Fprintf(&text, "• `%s %s`: %.2f vCPUs, %s memory\n", w.Namespace, w, totals[w].ReclaimCPU, o.byteCount(int64(totals[w].ReclaimMem)))
+	}
+	return text.String()
+}
+
+// notifyWebhook posts the digest of the run in the payload of the slack incoming webhooks
+func (o *Options) notifyWebhook(ctx context.Context) error {
+	content, err := json.Marshal(map[string]string{"text": o.webhookMessage()})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.WebhookURL, bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("could not notify the webhook: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not notify the webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("could not notify the webhook: %s %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
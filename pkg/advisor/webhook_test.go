@@ -0,0 +1,37 @@
+package advisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWebhookMessageStreamed(t *testing.T) {
+	recommendations := []Recommendation{
+		{Workload: Workload{Namespace: "shop", Kind: "deployment", Name: "cart"}, Container: "app", CPUSavings: 0.5, MemSavings: gib},
+		{Workload: Workload{Namespace: "shop", Kind: "deployment", Name: "checkout"}, Container: "app", CPUSavings: 2},
+		{Workload: Workload{Namespace: "shop", Kind: "deployment", Name: "cart"}, Container: "sidecar", CPUSavings: 0.25},
+		{Workload: Workload{Namespace: "shop", Kind: "deployment", Name: "search"}, Container: "app", CPUSavings: -1},
+	}
+	for _, stream := range []bool{false, true} {
+		o := &Options{ClusterName: "prod", WebhookTop: 2, CPUWeight: 1, MemWeight: 1, streamedSavings: make(map[Workload]savings)}
+		var out bytes.Buffer
+		if stream {
+			o.stream = json.NewEncoder(&out)
+		}
+		for _, rec := range recommendations {
+			o.addRecommendation(rec)
+		}
+
+		// the top list is the same whether the recommendations were kept or streamed
+		message := o.webhookMessage()
+		top := message[strings.Index(message, "Top savings:\n"):]
+		want := "Top savings:\n" +
+			"• `shop deployment/checkout`: 2.00 vCPUs, 0 B memory\n" +
+			"• `shop deployment/cart`: 0.75 vCPUs, 1.0 GiB memory\n"
+		if top != want {
+			t.Errorf("stream %t: top savings = %q, want %q", stream, top, want)
+		}
+	}
+}